@@ -0,0 +1,163 @@
+package main
+
+import (
+	"downloader/internal/config"
+	"downloader/internal/models"
+	"downloader/internal/ui"
+	"downloader/internal/utils"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+)
+
+// checkedRequest is a line of the input file as understood by the app, with its problems
+type checkedRequest struct {
+	Line     int      `json:"line"`
+	Url      string   `json:"url"`
+	Type     string   `json:"type"`    // "video", "video clip", "audio" or "audio clip"
+	Details  string   `json:"details"` // the quality or audio format, and the clip range
+	Site     string   `json:"site"`    // the name of the matched site profile
+	Problems []string `json:"problems,omitempty"`
+}
+
+// runCheck runs "downloader check [file]", which shows how each line of urls.txt (or of the given file) is understood
+// and reports the problems, without downloading anything
+func runCheck(o *options, args []string) {
+	inputFile := "urls.txt"
+	switch len(args) {
+	case 0:
+	case 1:
+		inputFile = args[0]
+	default:
+		o.flags.Usage()
+		exit(ExitInputError)
+	}
+
+	requests, err := utils.ReadRequestsFromFile(inputFile)
+	if err != nil {
+		fail(ExitInputError, fmt.Sprintf("Error reading urls from %s file:", inputFile), err)
+	}
+
+	siteRegistry, err := config.LoadSites()
+	if err != nil {
+		fail(ExitInputError, err)
+	}
+
+	profiles, err := config.LoadProfiles()
+	if err != nil {
+		fail(ExitInputError, err)
+	}
+
+	checked := make([]checkedRequest, len(requests))
+	problems := 0
+	for i, req := range requests {
+		var profileErr error
+		if req.Profile != "" {
+			var profile *config.Profile
+			if profile, profileErr = config.FindProfile(profiles, req.Profile); profileErr == nil {
+				req = profile.ApplyTokens(req)
+			}
+		}
+
+		checked[i] = checkRequest(req)
+		if profileErr != nil {
+			checked[i].Problems = append(checked[i].Problems, profileErr.Error())
+		}
+		checked[i].Site = siteRegistry.Match(req.Url).Name
+		problems += len(checked[i].Problems)
+	}
+
+	if ui.GetOutputMode() == ui.ModeJSON {
+		json.NewEncoder(os.Stdout).Encode(map[string]any{
+			"file":     inputFile,
+			"requests": checked,
+			"problems": problems,
+		})
+	} else {
+		printCheckedRequests(inputFile, checked, problems)
+	}
+
+	if problems > 0 || len(requests) == 0 {
+		exit(ExitInputError)
+	}
+	exit(ExitSuccess)
+}
+
+// checkRequest describes the request and finds the problems of its line
+func checkRequest(req models.DownloadRequest) checkedRequest {
+	checked := checkedRequest{
+		Line: req.Line,
+		Url:  req.Url,
+		Type: "video",
+	}
+
+	var details []string
+	if req.IsAudioOnly {
+		checked.Type = "audio"
+		details = append(details, strings.Trim(audioFormatLabel(req.AudioOutput), "()"))
+	} else {
+		details = append(details, req.Quality.String())
+	}
+
+	if u, err := url.Parse(req.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		checked.Problems = append(checked.Problems, fmt.Sprintf("%q is not a valid http or https URL", req.Url))
+	}
+
+	if req.IsClip {
+		checked.Type += " clip"
+		details = append(details, req.ClipTimeRange)
+
+		duration, err := utils.CalculateClipDurationInSeconds(req.ClipTimeRange)
+		switch {
+		case err != nil:
+			checked.Problems = append(checked.Problems, fmt.Sprintf("invalid clip range %q (expected HH:MM:SS-HH:MM:SS): %v", req.ClipTimeRange, err))
+		case duration <= 0:
+			checked.Problems = append(checked.Problems, fmt.Sprintf("the clip %q ends before it starts", req.ClipTimeRange))
+		}
+	}
+
+	for _, token := range req.UnknownTokens {
+		checked.Problems = append(checked.Problems, fmt.Sprintf("unknown token %q is ignored", token))
+	}
+
+	if req.Profile != "" {
+		details = append(details, "profile "+req.Profile)
+	}
+
+	checked.Details = strings.Join(details, ", ")
+	return checked
+}
+
+// printCheckedRequests prints the requests as a table followed by their problems
+func printCheckedRequests(inputFile string, checked []checkedRequest, problems int) {
+	if len(checked) == 0 {
+		ui.Errorln(fmt.Sprintf("%s has no download requests", inputFile))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tTYPE\tDETAILS\tSITE\tURL")
+	for _, c := range checked {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", c.Line, c.Type, c.Details, c.Site, c.Url)
+	}
+	w.Flush()
+	fmt.Println()
+
+	if problems == 0 {
+		fmt.Println(color.GreenString("%s looks good: %d download requests.", inputFile, len(checked)))
+		return
+	}
+
+	for _, c := range checked {
+		for _, problem := range c.Problems {
+			fmt.Println(color.RedString("line %d: %s", c.Line, problem))
+		}
+	}
+	fmt.Println()
+	fmt.Printf("%d problems found in %s.\n", problems, inputFile)
+}
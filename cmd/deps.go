@@ -0,0 +1,139 @@
+package main
+
+import (
+	"downloader/internal/config"
+	"downloader/internal/dependencies"
+	"downloader/internal/ui"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+)
+
+// dependencyInfo is an installed program, as shown by "deps"
+type dependencyInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Channel string `json:"channel,omitempty"` // the release channel of yt-dlp
+	Path    string `json:"path"`
+	Source  string `json:"source,omitempty"` // where it was found: config, bin or PATH
+	Error   string `json:"error,omitempty"`
+}
+
+// ensureDependencies installs the missing programs and updates yt-dlp, through the proxy of the settings,
+// or only checks that they are installed when offline. It exits if they can't be made ready.
+func ensureDependencies(settings *config.Settings, offline bool) {
+	dependencies.SetBinaryPaths(settings.BinaryPaths)
+	dependencies.SetOffline(offline)
+	dependencies.SetUpdateInterval(settings.UpdateInterval)
+	dependencies.SetProxy(settings.Proxy)
+	dependencies.SetYtDlpTarget(settings.YtDlp)
+	if err := dependencies.EnsureReady(); err != nil {
+		fail(ExitDependencyError, err)
+	}
+}
+
+// runDeps runs "downloader deps", which installs the missing programs, updates yt-dlp
+// and shows the installed versions, and "downloader deps rollback yt-dlp [version]"
+func runDeps(o *options, args []string) {
+	switch {
+	case len(args) == 0:
+	case len(args) >= 2 && len(args) <= 3 && args[0] == "rollback" && args[1] == "yt-dlp":
+		version := ""
+		if len(args) == 3 {
+			version = args[2]
+		}
+		rollbackYtDlp(o.loadSettings(), version)
+	case len(args) >= 2 && args[0] == "rollback":
+		fail(ExitInputError, fmt.Sprintf("only yt-dlp can be rolled back, not %s", args[1]))
+	default:
+		o.flags.Usage()
+		exit(ExitInputError)
+	}
+
+	ensureDependencies(o.loadSettings(), o.offline)
+
+	lock, err := dependencies.ReadLockFile()
+	if err != nil {
+		fail(ExitDependencyError, err)
+	}
+
+	var infos []dependencyInfo
+	failed := false
+	for _, program := range dependencies.Programs {
+		info := dependencyInfo{Name: program, Path: dependencies.BinaryPath(program)}
+		binary, err := dependencies.ResolveBinary(program)
+		if err != nil {
+			info.Error = err.Error()
+			failed = true
+		} else {
+			info.Version, info.Source = binary.Version, binary.Source
+		}
+		if info.Source == dependencies.SourceBinDir {
+			info.Channel = lock.Programs[program].Channel
+		}
+		infos = append(infos, info)
+	}
+
+	if ui.GetOutputMode() == ui.ModeJSON {
+		json.NewEncoder(os.Stdout).Encode(infos)
+	} else if ui.GetOutputMode() != ui.ModeQuiet {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PROGRAM\tVERSION\tFROM\tPATH")
+		for _, info := range infos {
+			version := info.Version
+			if info.Channel != "" {
+				version += " (" + info.Channel + ")"
+			}
+			if info.Error != "" {
+				version = "not working: " + info.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", info.Name, version, info.Source, info.Path)
+		}
+		w.Flush()
+
+		if path, err := dependencies.LockFilePath(); err == nil {
+			fmt.Println()
+			fmt.Println("Lock file:", path)
+		}
+	}
+
+	if failed {
+		exit(ExitDependencyError)
+	}
+	exit(ExitSuccess)
+}
+
+// rollbackYtDlp switches yt-dlp back to a kept version and pins it in the config file, so the next runs don't update it
+func rollbackYtDlp(settings *config.Settings, version string) {
+	if path := settings.BinaryPaths["yt-dlp"]; path != "" {
+		fail(ExitInputError, fmt.Sprintf("yt-dlp is set to %s by ytdlp_path, only the yt-dlp installed in the bin folder can be rolled back", path))
+	}
+	dependencies.SetBinaryPaths(settings.BinaryPaths)
+	previous, _ := dependencies.ProgramVersion("yt-dlp")
+
+	kept, err := dependencies.RollbackYtDlp(version)
+	if err != nil {
+		fail(ExitDependencyError, err)
+	}
+
+	pin := kept.Target().String()
+	if err := config.Remember("ytdlp_version", pin); err != nil {
+		ui.Errorln("Could not pin the version in the config file:", err)
+	}
+
+	if ui.GetOutputMode() == ui.ModeJSON {
+		json.NewEncoder(os.Stdout).Encode(map[string]string{
+			"previous": previous,
+			"version":  kept.Version,
+			"channel":  kept.Channel,
+		})
+		exit(ExitSuccess)
+	}
+
+	ui.Println(color.GreenString("Rolled back yt-dlp from %s to %s.", previous, kept.Version))
+	ui.Printf("Pinned ytdlp_version to %s in %s, set it to %s to follow the releases again.\n", pin, config.FilePath(), kept.Channel)
+	exit(ExitSuccess)
+}
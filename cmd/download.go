@@ -0,0 +1,398 @@
+package main
+
+import (
+	"downloader/internal/config"
+	"downloader/internal/downloader"
+	"downloader/internal/models"
+	"downloader/internal/ui"
+	"downloader/internal/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/gosuri/uiprogress"
+)
+
+// runDownload runs "downloader download [file]", which downloads the requests of urls.txt or of the given file
+func runDownload(o *options, args []string) {
+	inputFile := "urls.txt"
+	switch len(args) {
+	case 0:
+	case 1:
+		inputFile = args[0]
+	default:
+		o.flags.Usage()
+		exit(ExitInputError)
+	}
+
+	settings := o.loadSettings()
+
+	// Ensure all needed dependencies are ready
+	ensureDependencies(settings, o.offline)
+
+	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
+		fail(ExitInputError, inputFile+" file not found")
+	}
+
+	download(o, settings, "download", inputFile)
+}
+
+// runRetry runs "downloader retry", which downloads the requests of the latest failure file
+func runRetry(o *options, args []string) {
+	if len(args) > 0 {
+		o.flags.Usage()
+		exit(ExitInputError)
+	}
+
+	settings := o.loadSettings()
+
+	// Ensure all needed dependencies are ready
+	ensureDependencies(settings, o.offline)
+
+	inputFile, err := utils.LatestRetryFile(".")
+	if err != nil {
+		fail(ExitInputError, "Nothing to retry:", err)
+	}
+	ui.Println("Retrying the failed downloads from", inputFile)
+	ui.Println()
+
+	download(o, settings, "retry", inputFile)
+}
+
+// download downloads the requests of the input file and exits.
+// command is "download" or "retry", the failures of a retry are written to a new retry file.
+func download(o *options, settings *config.Settings, command, inputFile string) {
+	started := time.Now()
+	isRetry := command == "retry"
+
+	// read the download requests from the file
+	downloadRequests, err := utils.ReadRequestsFromFile(inputFile)
+
+	if err != nil {
+		fail(ExitInputError, fmt.Sprintf("Error reading urls from %s file:", inputFile), err)
+	}
+
+	// apply the named profiles of the lines (or the -profile one)
+	lineProfiles, err := applyProfiles(settings, downloadRequests)
+	if err != nil {
+		fail(ExitInputError, err)
+	}
+	lineSettings := profileSettings(settings, lineProfiles)
+
+	// The video format, clip mode and audio format are only asked for if they aren't set in the config file, profile,
+	// environment or flags, and the audio format only if an audio request doesn't have one on its line
+	needsVideoFormat := false
+	needsClipMode := false
+	needsAudioFormat := false
+
+	for _, req := range downloadRequests {
+		reqSettings := settingsFor(settings, lineSettings, req)
+		if req.IsAudioOnly {
+			needsAudioFormat = needsAudioFormat || req.AudioOutput.Format == "" && !reqSettings.IsSet("audio_format")
+		} else {
+			needsVideoFormat = needsVideoFormat || !reqSettings.IsSet("format")
+			needsClipMode = needsClipMode || req.IsClip && !reqSettings.IsSet("clip_mode")
+		}
+	}
+
+	// Without prompts, audio downloads keep their original format
+	needsAudioFormat = needsAudioFormat && ui.CanPrompt()
+
+	// Only show setup prompts if something is missing.
+	// With -yes the defaults are used, and when nobody can answer the prompts the missing values are an error.
+	if (needsVideoFormat || needsClipMode || needsAudioFormat) && !o.yes {
+		if !ui.CanPrompt() {
+			fail(ExitInputError, missingSettingsError(needsVideoFormat, needsClipMode))
+		}
+
+		// Show setup header
+		fmt.Println("Quick setup before we start...")
+		fmt.Println()
+
+		if needsVideoFormat {
+			// prompt the user to select the preferred video format
+			videoFormat, err := ui.PromptVideoFormat()
+			if err != nil {
+				fail(ExitInputError, "Error prompting video format:", err)
+			}
+			setFromPrompt(settings, "format", videoFormat.String())
+		}
+
+		// if there is any video clip request, prompt the user to select the clip download method
+		if needsClipMode {
+			if needsVideoFormat {
+				fmt.Println()
+			}
+			shouldReEncode, err := ui.PromptClipDownloadMethod()
+			if err != nil {
+				fail(ExitInputError, "Error prompting clip download method:", err)
+			}
+
+			clipMode := config.ClipModeFast
+			if shouldReEncode {
+				clipMode = config.ClipModeAccurate
+			}
+			setFromPrompt(settings, "clip_mode", clipMode)
+		}
+
+		// prompt the user to select the format audio downloads are converted to
+		if needsAudioFormat {
+			if needsVideoFormat || needsClipMode {
+				fmt.Println()
+			}
+			audioFormat, err := ui.PromptAudioFormat()
+			if err != nil {
+				fail(ExitInputError, "Error prompting audio format:", err)
+			}
+			setFromPrompt(settings, "audio_format", audioFormat)
+		}
+	}
+
+	// initialize config and downloader
+	cfg := newConfig(o, settings, lineProfiles)
+
+	if o.dryRun {
+		printDryRun(cfg, downloadRequests)
+		exit(ExitSuccess)
+	}
+
+	clipEncoder, _ := downloader.ClipEncoder(cfg.VideoFormat, cfg.Encoder, cfg.EncoderArgs)
+	downloader := downloader.New(cfg)
+
+	// Ctrl+C doesn't reach yt-dlp and ffmpeg, they run in their own process groups: kill them before exiting,
+	// otherwise they would keep downloading in the background
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupted
+		downloader.Stop()
+		if ui.IsInteractive() {
+			uiprogress.Stop()
+		}
+		ui.Errorln()
+		ui.Errorln("Interrupted, the downloads were stopped.")
+		os.Exit(ExitInterrupted)
+	}()
+
+	// Add spacing between prompts and downloads
+	ui.Println()
+	ui.Println("Starting downloads...")
+	ui.Println("----------------------------------------")
+	ui.Println("Please keep the app open until you see “All downloads completed”. This ensures every download finishes correctly.")
+	ui.Println()
+
+	// Print the encoder that will be used for clips
+	if cfg.ShouldReEncode {
+		if clipEncoder != cfg.Encoder {
+			ui.Println(color.CyanString("%s makes %s video, which %s can't hold. Using CPU encoder: %s",
+				cfg.Encoder, strings.ToUpper(config.EncoderCodec(cfg.Encoder)), strings.ToUpper(cfg.VideoFormat.Container), clipEncoder))
+
+		} else if settings.IsSet("encoder") {
+			ui.Println(color.CyanString("Using encoder: %s", cfg.Encoder))
+
+		} else if cfg.Encoder == config.VP9Encoder {
+			ui.Println(color.CyanString("Using CPU encoder for WebM: %s", cfg.Encoder))
+
+		} else if config.IsSoftwareEncoder(cfg.Encoder) {
+			ui.Println(color.CyanString("Could not use GPU encoder. Falling back to CPU encoder: %s", cfg.Encoder))
+
+		} else {
+			ui.Println(color.CyanString("Using GPU encoder: %s", cfg.Encoder))
+		}
+		ui.Println()
+	}
+
+	// Start the progress rendering system
+	if ui.IsInteractive() {
+		uiprogress.Start()
+	}
+
+	// start downloading videos concurrently
+	wg := sync.WaitGroup{}
+	wg.Add(len(downloadRequests))
+	var failedCount atomic.Int32
+
+	for i, downloadRequest := range downloadRequests {
+		go func() {
+
+			// Prepare the progress label based on the download request type
+			progressLabel := "\n"
+
+			if downloadRequest.IsAudioOnly {
+				// Audio download
+				audioFormat := audioFormatLabel(cfg.ForRequest(downloadRequest).AudioOutput.WithOverrides(downloadRequest.AudioOutput))
+
+				if downloadRequest.IsClip {
+					durationText := utils.FormatClipDurationText(downloadRequest.ClipTimeRange)
+					progressLabel += fmt.Sprintf("Downloading audio clip %s\nDuration: %s\nURL: %s", color.CyanString(audioFormat), durationText, downloadRequest.Url)
+				} else {
+					progressLabel += fmt.Sprintf("Downloading full audio %s\nURL: %s", color.CyanString(audioFormat), downloadRequest.Url)
+				}
+			} else {
+				// Video download
+				quality := fmt.Sprintf("(%s)", downloadRequest.Quality)
+
+				if downloadRequest.IsClip {
+					durationText := utils.FormatClipDurationText(downloadRequest.ClipTimeRange)
+					progressLabel += fmt.Sprintf("Downloading clip %s\nDuration: %s\nURL: %s", color.CyanString(quality), durationText, downloadRequest.Url)
+				} else {
+					progressLabel += fmt.Sprintf("Downloading full video %s\nURL: %s", color.CyanString(quality), downloadRequest.Url)
+				}
+			}
+
+			// Show the progress bar
+			downloadProgress := ui.ShowDownloadProgress(i+1, downloadRequest, progressLabel)
+
+			// Start the download and get the progress channel.
+			// It stays queued until its site has a free download slot.
+			startedChan, progressChan, restartChan, resultChan := downloader.Download(downloadRequest)
+			<-startedChan
+			downloadProgress.Start()
+
+			// Update the progress bar with the progress and the restarts of stalled attempts,
+			// until both channels are closed
+			for progressChan != nil || restartChan != nil {
+				select {
+				case progress, ok := <-progressChan:
+					if !ok {
+						progressChan = nil
+						continue
+					}
+					downloadProgress.Set(progress)
+				case restart, ok := <-restartChan:
+					if !ok {
+						restartChan = nil
+						continue
+					}
+					downloadProgress.Restart(restart)
+				}
+			}
+
+			// Report how the download ended
+			if downloadErr := <-resultChan; downloadErr != nil {
+				downloadProgress.Fail(downloadErr)
+				failedCount.Add(1)
+			} else {
+				downloadProgress.Finish()
+			}
+
+			// Signal that the download process is complete
+			wg.Done()
+		}()
+	}
+
+	// ensure all goroutines complete
+	wg.Wait()
+
+	// Stop the progress rendering system
+	if ui.IsInteractive() {
+		uiprogress.Stop()
+	}
+
+	// If there are errors (including restarted downloads), show them.
+	// In JSON mode every failure and restart was already reported as an event.
+	if downloader.ErrorCollector.HasErrors() && ui.GetOutputMode() != ui.ModeJSON {
+		ui.Errorln()
+		ui.Errorln("----------------------------------------")
+		ui.PrintErrorReport(downloader.ErrorCollector.GetAll())
+	}
+
+	if logDir := downloader.RunLogDir(); logDir != "" {
+		ui.Println()
+		ui.Println("Download logs:", logDir)
+	}
+
+	// The retried file is done, its failures are written to a new one below
+	if isRetry {
+		if err := utils.MarkRetryFileDone(inputFile); err != nil {
+			ui.Errorln("Could not rename the retried file:", err)
+		}
+	}
+
+	retryFile := ""
+
+	if failedCount.Load() > 0 {
+		ui.Println()
+		ui.Println(fmt.Sprintf("All downloads completed. %d of %d failed.", failedCount.Load(), len(downloadRequests)))
+
+		// Save the failed lines so they can be retried with "downloader retry"
+		retryFile, err = utils.WriteRetryFile(".", downloader.ErrorCollector.GetAll())
+		if err != nil {
+			ui.Errorln(err)
+		} else {
+			ui.Println(fmt.Sprintf("The failed downloads were saved to %s. Run \"downloader retry\" to try them again.", retryFile))
+			ui.EmitEvent(ui.Event{Event: "retry_file", Message: retryFile})
+		}
+	} else {
+		ui.Println()
+		ui.Println("All downloads completed successfully.")
+	}
+
+	exitCode := exitCodeFor(len(downloadRequests), int(failedCount.Load()))
+
+	// Save the summary of the run for "downloader history"
+	err = downloader.WriteRunSummary(&models.RunSummary{
+		Command:   command,
+		InputFile: inputFile,
+		Started:   started,
+		Finished:  time.Now(),
+		Total:     len(downloadRequests),
+		Failed:    int(failedCount.Load()),
+		ExitCode:  exitCode,
+		RetryFile: retryFile,
+	})
+	if err != nil {
+		ui.Errorln(err)
+	}
+
+	// Keep the window open so the summary can be read, then report how the run ended
+	exit(exitCode)
+}
+
+// audioFormatLabel describes the audio conversion for the progress label, e.g. "(MP3 192K)" or "(best quality)"
+func audioFormatLabel(output models.AudioOutput) string {
+	if output.Format == "" {
+		return "(best quality)"
+	}
+
+	label := strings.ToUpper(output.Format)
+	switch {
+	case output.IsLossless():
+	case output.Quality == "":
+		label += " best quality"
+	case strings.HasSuffix(output.Quality, "K"):
+		label += " " + output.Quality
+	default:
+		label += " VBR q" + output.Quality
+	}
+
+	return "(" + label + ")"
+}
+
+// printDryRun prints the command of each request instead of running it
+func printDryRun(cfg *config.Config, requests []models.DownloadRequest) {
+	if ui.GetOutputMode() == ui.ModeJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, req := range requests {
+			encoder.Encode(map[string]any{
+				"line":    req.Line,
+				"url":     req.Url,
+				"command": downloader.CommandLine(cfg, req),
+			})
+		}
+		return
+	}
+
+	for _, req := range requests {
+		fmt.Printf("# line %d: %s\n", req.Line, req.Raw)
+		fmt.Println(downloader.CommandLine(cfg, req))
+		fmt.Println()
+	}
+}
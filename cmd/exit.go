@@ -0,0 +1,62 @@
+package main
+
+import (
+	"downloader/internal/ui"
+	"fmt"
+	"os"
+)
+
+// Exit codes, so wrappers and scripts can tell how the run ended
+const (
+	ExitSuccess         = 0 // all downloads succeeded
+	ExitPartialFailure  = 1 // some downloads failed
+	ExitAllFailed       = 2 // every download failed
+	ExitInputError      = 3 // invalid flags, missing or unreadable urls.txt, or a prompt could not be answered
+	ExitDependencyError = 4 // the dependencies could not be installed or updated
+
+	ExitInterrupted = 130 // the app was stopped with Ctrl+C or a termination signal, like a shell reports it
+)
+
+var (
+	// noWait is set by the -no-wait flag of every command
+	noWait bool
+
+	// waitOnExit is set for the commands that pause before exiting (see command.waitOnExit)
+	waitOnExit bool
+)
+
+// shouldWait returns true if the app should wait for Enter before exiting.
+// The pause keeps the window open for users who start the app by double-clicking it,
+// which only runs the download command.
+func shouldWait() bool {
+	return waitOnExit && !noWait && ui.CanPrompt()
+}
+
+// exit waits for Enter (only for the download and retry commands, unless disabled) and exits with the given code
+func exit(code int) {
+	if shouldWait() {
+		ui.Println()
+		ui.Println("Press Enter to exit...")
+		var input string
+		fmt.Scanln(&input)
+	}
+	os.Exit(code)
+}
+
+// fail prints the error and exits with the given code
+func fail(code int, a ...any) {
+	ui.Errorln(a...)
+	exit(code)
+}
+
+// exitCodeFor returns the exit code for a run with the given number of requests and failures
+func exitCodeFor(total, failed int) int {
+	switch {
+	case failed == 0:
+		return ExitSuccess
+	case failed < total:
+		return ExitPartialFailure
+	default:
+		return ExitAllFailed
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"downloader/internal/config"
+	"downloader/internal/downloader"
+	"downloader/internal/models"
+	"downloader/internal/ui"
+	"downloader/internal/utils"
+	"strings"
+)
+
+// runFormats runs "downloader formats <url> [tokens]", which lists the formats available for a URL
+// and marks the ones that would be downloaded.
+// args are the URL followed by the same tokens as a line of urls.txt, e.g. "https://... 720p h264"
+func runFormats(o *options, args []string) {
+	if len(args) == 0 {
+		o.flags.Usage()
+		exit(ExitInputError)
+	}
+
+	settings := o.loadSettings()
+
+	ensureDependencies(settings, o.offline)
+
+	requests := []models.DownloadRequest{utils.ParseDownloadRequest(strings.Join(args, " "))}
+	lineProfiles, err := applyProfiles(settings, requests)
+	if err != nil {
+		fail(ExitInputError, err)
+	}
+	req := requests[0]
+
+	// the picked format depends on the video format, ask for it like a download does
+	reqSettings := settingsFor(settings, profileSettings(settings, lineProfiles), req)
+	if !req.IsAudioOnly && !reqSettings.IsSet("format") && !o.yes {
+		if !ui.CanPrompt() {
+			fail(ExitInputError, missingSettingsError(true, false))
+		}
+		videoFormat, err := ui.PromptVideoFormat()
+		if err != nil {
+			fail(ExitInputError, "Error prompting video format:", err)
+		}
+		setFromPrompt(settings, "format", videoFormat.String())
+		ui.Println()
+	}
+
+	// only the format matters, no encoder is needed
+	settings.Set("clip_mode", config.ClipModeFast, config.SourceDefault)
+
+	cfg := newConfig(o, settings, lineProfiles)
+
+	loading := ui.ShowLoading("Reading the available formats...")
+	list, err := downloader.ListFormats(cfg, req)
+	if err != nil {
+		loading.Fail(err.Error())
+		ui.StopMultiPrinter()
+		exit(ExitAllFailed)
+	}
+	loading.Complete("Formats found")
+	ui.StopMultiPrinter()
+	ui.Println()
+
+	ui.PrintFormats(list)
+	exit(ExitSuccess)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"downloader/internal/config"
+	"downloader/internal/downloader"
+	"downloader/internal/ui"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runHistory runs "downloader history", which lists the summaries of the previous runs, the most recent first
+func runHistory(o *options, args []string) {
+	if len(args) > 0 {
+		o.flags.Usage()
+		exit(ExitInputError)
+	}
+
+	summaries, err := downloader.ReadRunSummaries(config.DefaultLogDir)
+	if err != nil {
+		fail(ExitInputError, "Error reading the run history:", err)
+	}
+	if o.limit > 0 && len(summaries) > o.limit {
+		summaries = summaries[:o.limit]
+	}
+
+	if ui.GetOutputMode() == ui.ModeJSON {
+		json.NewEncoder(os.Stdout).Encode(summaries)
+		exit(ExitSuccess)
+	}
+
+	if len(summaries) == 0 {
+		fmt.Println("No download runs yet. The history is kept in the logs folder.")
+		exit(ExitSuccess)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STARTED\tCOMMAND\tFILE\tREQUESTS\tFAILED\tDURATION\tLOGS")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			s.Started.Format("2006-01-02 15:04"),
+			s.Command,
+			s.InputFile,
+			s.Total,
+			s.Failed,
+			s.Finished.Sub(s.Started).Round(time.Second),
+			s.LogDir,
+		)
+	}
+	w.Flush()
+
+	exit(ExitSuccess)
+}
@@ -1,183 +1,181 @@
 package main
 
 import (
-	"downloader/internal/config"
-	"downloader/internal/dependencies"
-	"downloader/internal/downloader"
-	"downloader/internal/models"
-	"downloader/internal/ui"
-	"downloader/internal/utils"
 	"fmt"
-	"log"
 	"os"
-	"sync"
-
-	"github.com/fatih/color"
-	"github.com/gosuri/uiprogress"
+	"strings"
 )
 
-func main() {
+// command is a subcommand of the app: "downloader <name> [flags] <args>"
+type command struct {
+	name    string
+	args    string // the arguments in the usage line, e.g. "<url> [tokens]"
+	summary string // one line shown in the command list
+	help    string // more details shown by "downloader help <name>", if any
 
-	// Ensure all needed dependencies are ready
-	err := dependencies.EnsureReady()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// check if the urls.txt file exists
-	if _, err := os.Stat("urls.txt"); os.IsNotExist(err) {
-		log.Fatal("urls.txt file not found in the current directory")
-	}
+	// true if the command waits for Enter before exiting, so the window stays open when the app is double-clicked
+	waitOnExit bool
 
-	// read urls from file
-	urls, err := utils.ReadLinesFromFile("urls.txt")
-
-	if err != nil {
-		log.Fatal("Error reading urls from urls.txt file \n", err)
-	}
+	// flags registers the option groups of the command besides the global ones
+	flags func(o *options)
+	run   func(o *options, args []string)
+}
 
-	// parse urls into download requests and check if there are video clip requests
-	downloadRequests := make([]models.DownloadRequest, len(urls))
-	hasVideoRequests := false
-	hasVideoClipRequests := false
+// commands lists the commands in the order of the help
+var commands = []*command{
+	{
+		name:       "download",
+		args:       "[file]",
+		summary:    "Download the requests of urls.txt, or of the given file (the default command)",
+		waitOnExit: true,
+		flags: func(o *options) {
+			o.addYesFlag()
+			o.addDryRunFlag()
+			o.addOfflineFlag()
+			o.addProfileFlag()
+			o.addSettingFlags()
+			o.addPreferenceFlags()
+			o.addRunFlags()
+		},
+		run: runDownload,
+	},
+	{
+		name:       "retry",
+		summary:    "Download the requests of the latest failed-<time>.txt file again",
+		waitOnExit: true,
+		flags: func(o *options) {
+			o.addYesFlag()
+			o.addDryRunFlag()
+			o.addOfflineFlag()
+			o.addProfileFlag()
+			o.addSettingFlags()
+			o.addPreferenceFlags()
+			o.addRunFlags()
+		},
+		run: runRetry,
+	},
+	{
+		name:    "check",
+		args:    "[file]",
+		summary: "Check the lines of urls.txt, or of the given file, without downloading anything",
+		flags:   func(o *options) {},
+		run:     runCheck,
+	},
+	{
+		name:    "formats",
+		args:    "<url> [tokens]",
+		summary: "List the formats available for a URL and mark the ones that would be downloaded",
+		help:    "The tokens are the same as on a line of urls.txt, e.g. \"720p h264\" or \"audio\".",
+		flags: func(o *options) {
+			o.addYesFlag()
+			o.addOfflineFlag()
+			o.addProfileFlag()
+			o.addSettingFlags()
+			o.addPreferenceFlags()
+		},
+		run: runFormats,
+	},
+	{
+		name:    "deps",
+		args:    "[rollback yt-dlp [version]]",
+		summary: "Install or update yt-dlp, ffmpeg and deno and show their versions, or roll yt-dlp back",
+		help:    "\"deps rollback yt-dlp\" switches back to the yt-dlp used before the last update (or to the given kept version)\nand pins it in the config file, so it isn't updated again.",
+		flags: func(o *options) {
+			o.addOfflineFlag()
+			o.addSettingFlags("proxy", "ytdlp_version", "update_interval", "ytdlp_path", "ffmpeg_path", "deno_path")
+		},
+		run: runDeps,
+	},
+	{
+		name:    "history",
+		summary: "List the previous download runs",
+		flags: func(o *options) {
+			o.flags.IntVar(&o.limit, "limit", 10, "how many runs to list, the most recent first (0 lists all)")
+		},
+		run: runHistory,
+	},
+	{
+		name:    "config",
+		args:    "show|profiles|import-cookies <file> [name]",
+		summary: "Show the settings and where each one comes from, list the named profiles, or import a cookie file",
+		help:    "import-cookies copies a Netscape cookie file to the cookies folder of the app data directory, readable only by you.\nUse its name in the \"cookies\" setting or in the \"cookies\" of a site profile.",
+		flags: func(o *options) {
+			o.addProfileFlag()
+			o.addSettingFlags()
+		},
+		run: runConfig,
+	},
+}
 
-	for i, url := range urls {
-		downloadRequests[i] = utils.ParseDownloadRequest(url)
-		if !downloadRequests[i].IsAudioOnly {
-			hasVideoRequests = true
-			if downloadRequests[i].IsClip {
-				hasVideoClipRequests = true
-			}
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
 		}
 	}
+	return nil
+}
 
-	// Only show setup prompts if there are video requests
-	preferredFormat := models.FormatAny
-	shouldReEncode := false
-
-	if hasVideoRequests {
-		// Show setup header
-		fmt.Println("Quick setup before we start...")
-		fmt.Println()
-
-		// prompt the user to select the preferred video format
-		var err error
-		preferredFormat, err = ui.PromptVideoFormat()
-		if err != nil {
-			log.Fatal("Error prompting video format", err)
-		}
-
-		// if there is any video clip request, prompt the user to select the clip download method
-		if hasVideoClipRequests {
-			fmt.Println()
-			shouldReEncode, err = ui.PromptClipDownloadMethod()
-			if err != nil {
-				log.Fatal("Error prompting clip download method", err)
-			}
+func main() {
+	args := os.Args[1:]
+
+	// "downloader [flags]" is the same as "downloader download [flags]"
+	cmd := findCommand("download")
+	if len(args) > 0 {
+		switch {
+		case args[0] == "help":
+			runHelp(args[1:])
+		case args[0] == "-h" || args[0] == "-help" || args[0] == "--help":
+			printUsage()
+			os.Exit(ExitSuccess)
+		case strings.HasPrefix(args[0], "-"):
+		case findCommand(args[0]) != nil:
+			cmd = findCommand(args[0])
+			args = args[1:]
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+			printUsage()
+			os.Exit(ExitInputError)
 		}
 	}
 
-	// initialize config and downloader
-	cfg := config.New(shouldReEncode, preferredFormat)
-	downloader := downloader.New(cfg)
-
-	// Add spacing between prompts and downloads
-	fmt.Println()
-	fmt.Println("Starting downloads...")
-	fmt.Println("----------------------------------------")
-	fmt.Println("Please keep the app open until you see “All downloads completed”. This ensures every download finishes correctly.")
-	fmt.Println()
+	waitOnExit = cmd.waitOnExit
 
-	// Print the encoder that will be used for clips
-	if shouldReEncode {
-		if cfg.Encoder == config.CPUEncoder {
-			color.Cyan("Could not use GPU encoder. Falling back to CPU encoder: %s\n", cfg.Encoder)
+	o := newOptions(cmd)
+	cmd.flags(o)
+	cmd.run(o, o.parse(args))
+}
 
-		} else {
-			color.Cyan("Using GPU encoder: %s\n", cfg.Encoder)
-		}
-		fmt.Println()
+// runHelp runs "downloader help [command]"
+func runHelp(args []string) {
+	if len(args) == 0 {
+		printUsage()
+		os.Exit(ExitSuccess)
 	}
 
-	// Start the progress rendering system
-	uiprogress.Start()
-
-	// start downloading videos concurrently
-	wg := sync.WaitGroup{}
-	wg.Add(len(downloadRequests))
-
-	for _, downloadRequest := range downloadRequests {
-		go func() {
-
-			// Prepare the progress label based on the download request type
-			progressLabel := "\n"
-
-			if downloadRequest.IsAudioOnly {
-				// Audio download
-				if downloadRequest.IsClip {
-					durationText := utils.FormatClipDurationText(downloadRequest.ClipTimeRange)
-					progressLabel += fmt.Sprintf("Downloading audio clip %s\nDuration: %s\nURL: %s", color.CyanString("(best quality)"), durationText, downloadRequest.Url)
-				} else {
-					progressLabel += fmt.Sprintf("Downloading full audio %s\nURL: %s", color.CyanString("(best quality)"), downloadRequest.Url)
-				}
-			} else {
-				// Video download
-				quality := ""
-				if downloadRequest.Quality != "" {
-					quality = fmt.Sprintf("(%sp)", downloadRequest.Quality)
-				} else {
-					quality = "(best quality)"
-				}
-
-				if downloadRequest.IsClip {
-					durationText := utils.FormatClipDurationText(downloadRequest.ClipTimeRange)
-					progressLabel += fmt.Sprintf("Downloading clip %s\nDuration: %s\nURL: %s", color.CyanString(quality), durationText, downloadRequest.Url)
-				} else {
-					progressLabel += fmt.Sprintf("Downloading full video %s\nURL: %s", color.CyanString(quality), downloadRequest.Url)
-				}
-			}
-
-			// Show the progress bar
-			downloadProgressBar := ui.ShowDownloadProgress(progressLabel)
-
-			// Start the download and get the progress channel
-			progressChan := downloader.Download(downloadRequest)
-
-			// Update the progress bar with the progress from the progress channel
-			for progress := range progressChan {
-				downloadProgressBar.Set(progress)
-			}
-
-			// Signal that the download process is complete
-			wg.Done()
-		}()
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+		printUsage()
+		os.Exit(ExitInputError)
 	}
 
-	// ensure all goroutines complete
-	wg.Wait()
-
-	// Stop the progress rendering system
-	uiprogress.Stop()
+	o := newOptions(cmd)
+	cmd.flags(o)
+	o.flags.SetOutput(os.Stdout)
+	o.flags.Usage()
+	os.Exit(ExitSuccess)
+}
 
-	// If there are errors, show them and wait for user input before exiting
-	if downloader.ErrorCollector.HasErrors() {
-		errors := downloader.ErrorCollector.GetAll()
-		fmt.Println()
-		fmt.Println("----------------------------------------")
-		fmt.Println(color.RedString("Errors:"))
-		fmt.Println()
-		for _, err := range errors {
-			fmt.Println(err)
-			fmt.Println("-------------------------")
-		}
-		fmt.Println()
-		fmt.Println("All downloads completed.")
-		var input string
-		fmt.Scanln(&input)
-	} else {
-		fmt.Println()
-		fmt.Println("All downloads completed successfully.")
-		var input string
-		fmt.Scanln(&input)
+// printUsage prints the list of commands
+func printUsage() {
+	fmt.Println("Usage: downloader [command] [flags] [arguments]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, cmd := range commands {
+		fmt.Printf("  %-9s %s\n", cmd.name, cmd.summary)
 	}
+	fmt.Println()
+	fmt.Println("Without a command, the requests of urls.txt are downloaded.")
+	fmt.Println("Run \"downloader help <command>\" or \"downloader <command> -h\" to see the flags of a command.")
 }
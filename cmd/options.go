@@ -0,0 +1,186 @@
+package main
+
+import (
+	"downloader/internal/config"
+	"downloader/internal/ui"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// options are the command line options of a command. Every command has the global options,
+// and registers the groups of options it uses before the arguments are parsed.
+type options struct {
+	flags *flag.FlagSet
+
+	output  string // the output mode
+	yes     bool   // use the defaults instead of asking
+	dryRun  bool   // print the commands instead of running them
+	offline bool   // use the installed programs without any network access
+	profile string // the named profile of the config file to apply
+
+	// the setting flags (-path, -format...), by flag name
+	settings map[string]*string
+
+	// the other options passed to config.New
+	config      config.Options
+	verbose     bool
+	veryVerbose bool
+
+	limit int // how many runs "history" lists
+}
+
+func newOptions(cmd *command) *options {
+	o := &options{
+		flags:    flag.NewFlagSet(cmd.name, flag.ContinueOnError),
+		settings: make(map[string]*string),
+		config:   config.DefaultOptions(),
+	}
+
+	o.flags.StringVar(&o.output, "output", "auto", "output mode: auto, interactive, plain, json or quiet (auto uses interactive on a terminal and plain otherwise)")
+	o.flags.BoolVar(&noWait, "no-wait", false, "exit without waiting for Enter at the end of download and retry (automatic when stdin is not a terminal)")
+
+	o.flags.Usage = func() {
+		out := o.flags.Output()
+		fmt.Fprintf(out, "Usage: downloader %s [flags] %s\n\n%s\n", cmd.name, cmd.args, cmd.summary)
+		if cmd.help != "" {
+			fmt.Fprintf(out, "\n%s\n", cmd.help)
+		}
+		fmt.Fprintln(out, "\nFlags:")
+		o.flags.PrintDefaults()
+	}
+
+	return o
+}
+
+// addYesFlag registers -yes, for the commands that ask for missing settings
+func (o *options) addYesFlag() {
+	o.flags.BoolVar(&o.yes, "yes", false, "don't ask anything, use the defaults for the settings that are not set")
+}
+
+// addSettingFlags registers the flags of the settings that can also be set in the config file and environment.
+// Without names, the flags of all the settings are registered.
+func (o *options) addSettingFlags(names ...string) {
+	for _, setting := range config.SettingFlags() {
+		if len(names) > 0 && !slices.Contains(names, setting.Name) {
+			continue
+		}
+		usage := setting.Usage
+		if setting.DefaultValue != "" {
+			usage += fmt.Sprintf(" (default %q)", setting.DefaultValue)
+		}
+		o.settings[setting.Flag] = o.flags.String(setting.Flag, "", usage)
+	}
+}
+
+// addOfflineFlag registers -offline, for the commands that install the missing programs and update yt-dlp
+func (o *options) addOfflineFlag() {
+	o.flags.BoolVar(&o.offline, "offline", false, "use the installed yt-dlp, ffmpeg and deno without checking for updates or downloading anything")
+}
+
+// addDryRunFlag registers -dry-run, for the commands that download
+func (o *options) addDryRunFlag() {
+	o.flags.BoolVar(&o.dryRun, "dry-run", false, "print the yt-dlp command of each request, with the secrets hidden, instead of downloading")
+}
+
+// addProfileFlag registers -profile, for the commands that use the settings
+func (o *options) addProfileFlag() {
+	o.flags.StringVar(&o.profile, "profile", "", "named profile of the config file to apply, e.g. podcast (see \"downloader config profiles\")")
+}
+
+// addPreferenceFlags registers the global format preferences and the audio quality
+func (o *options) addPreferenceFlags() {
+	o.flags.StringVar(&o.config.Codecs, "codec", "", "preferred video codecs in order, e.g. h264,vp9 (h264, h265/hevc, vp9, av1)")
+	o.flags.IntVar(&o.config.MaxFPS, "max-fps", 0, "highest video frame rate, e.g. 30 (0 means no limit)")
+	o.flags.StringVar(&o.config.DynamicRange, "dynamic-range", "", "preferred dynamic range: sdr, hdr or any")
+	o.flags.IntVar(&o.config.MaxBitrate, "max-bitrate", 0, "highest video bitrate in kbps, e.g. 5000 (0 means no limit)")
+	o.flags.StringVar(&o.config.AudioLanguages, "audio-lang", "", "preferred audio languages in order, e.g. ar,en")
+	o.flags.BoolVar(&o.config.AllAudioTracks, "all-audio", false, "keep every audio track of videos (MP4, MKV and MOV, or any format)")
+	o.flags.StringVar(&o.config.AudioQuality, "audio-quality", "", "bitrate (e.g. 192k) or VBR quality from q0 (best) to q10 for converted audio (default: best)")
+}
+
+// addRunFlags registers the options of download runs: timeouts, restarts and logs
+func (o *options) addRunFlags() {
+	o.flags.DurationVar(&o.config.StallTimeout, "stall-timeout", o.config.StallTimeout, "restart a download that makes no progress for this long (0 disables the check)")
+	o.flags.DurationVar(&o.config.JobTimeout, "job-timeout", o.config.JobTimeout, "restart a download that runs longer than this (e.g. 2h, 0 means no limit)")
+	o.flags.IntVar(&o.config.StallRestarts, "stall-restarts", o.config.StallRestarts, "how many times a stalled download is restarted before it is reported as failed")
+	o.flags.IntVar(&o.config.KeepLogs, "keep-logs", o.config.KeepLogs, "how many runs of download logs to keep in the logs folder (0 keeps all)")
+	o.flags.BoolVar(&o.verbose, "v", false, "verbose logs: run yt-dlp with --verbose")
+	o.flags.BoolVar(&o.veryVerbose, "vv", false, "very verbose logs: run yt-dlp with --verbose and --print-traffic")
+}
+
+// parse parses the flags placed anywhere among the arguments (e.g. "formats <url> -output json")
+// and returns the other arguments in order. It also selects the output mode, before anything is printed.
+func (o *options) parse(args []string) []string {
+	var positional []string
+	for {
+		if err := o.flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+			os.Exit(ExitSuccess)
+		} else if err != nil {
+			os.Exit(ExitInputError)
+		}
+
+		args = o.flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	switch {
+	case o.veryVerbose:
+		o.config.Verbosity = 2
+	case o.verbose:
+		o.config.Verbosity = 1
+	}
+
+	outputMode, err := ui.ParseOutputMode(o.output)
+	if err != nil {
+		fail(ExitInputError, err)
+	}
+	ui.SetOutputMode(outputMode)
+
+	return positional
+}
+
+// isSet returns true if the flag was given on the command line
+func (o *options) isSet(name string) bool {
+	isSet := false
+	o.flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			isSet = true
+		}
+	})
+	return isSet
+}
+
+// loadSettings resolves the settings from the config file, the -profile profile, environment variables and the setting flags
+func (o *options) loadSettings() *config.Settings {
+	var profile *config.Profile
+	if o.profile != "" {
+		profiles, err := config.LoadProfiles()
+		if err != nil {
+			fail(ExitInputError, err)
+		}
+		profile, err = config.FindProfile(profiles, o.profile)
+		if err != nil {
+			fail(ExitInputError, err)
+		}
+	}
+
+	flagValues := make(map[string]string)
+	for name, value := range o.settings {
+		if o.isSet(name) {
+			flagValues[name] = *value
+		}
+	}
+
+	settings, err := config.LoadSettings(flagValues, profile)
+	if err != nil {
+		fail(ExitInputError, err)
+	}
+	return settings
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"downloader/internal/config"
+	"downloader/internal/models"
+	"fmt"
+)
+
+// applyProfiles adds the tokens of their profile to the requests. The lines without a "profile:<name>" token
+// use the -profile one. It returns the other profiles used by the lines.
+func applyProfiles(settings *config.Settings, requests []models.DownloadRequest) ([]*config.Profile, error) {
+	profiles, err := config.LoadProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var lineProfiles []*config.Profile
+	used := make(map[string]bool)
+
+	for i := range requests {
+		if requests[i].Profile == "" {
+			requests[i].Profile = settings.Profile
+		}
+		if requests[i].Profile == "" {
+			continue
+		}
+
+		profile, err := config.FindProfile(profiles, requests[i].Profile)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", requests[i].Line, err)
+		}
+		requests[i] = profile.ApplyTokens(requests[i])
+
+		if profile.Name != settings.Profile && !used[profile.Name] {
+			used[profile.Name] = true
+			lineProfiles = append(lineProfiles, profile)
+		}
+	}
+
+	return lineProfiles, nil
+}
+
+// profileSettings returns the settings with each profile applied, by profile name
+func profileSettings(settings *config.Settings, profiles []*config.Profile) map[string]*config.Settings {
+	lineSettings := make(map[string]*config.Settings)
+	for _, profile := range profiles {
+		s, err := settings.WithProfile(profile)
+		if err != nil {
+			fail(ExitInputError, err)
+		}
+		lineSettings[profile.Name] = s
+	}
+	return lineSettings
+}
+
+// settingsFor returns the settings of the request's profile
+func settingsFor(settings *config.Settings, lineSettings map[string]*config.Settings, req models.DownloadRequest) *config.Settings {
+	if s, ok := lineSettings[req.Profile]; ok {
+		return s
+	}
+	return settings
+}
+
+// newConfig creates the config, with the configs of the profiles used by the lines
+func newConfig(o *options, settings *config.Settings, lineProfiles []*config.Profile) *config.Config {
+	cfg, err := config.New(settings, o.config)
+	if err != nil {
+		fail(ExitInputError, err)
+	}
+
+	// the profile settings are created from the final settings, so they also get the answers of the prompts
+	for name, s := range profileSettings(settings, lineProfiles) {
+		cfg.Profiles[name], err = config.New(s, o.config)
+		if err != nil {
+			fail(ExitInputError, err)
+		}
+	}
+
+	return cfg
+}
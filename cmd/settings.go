@@ -0,0 +1,176 @@
+package main
+
+import (
+	"downloader/internal/config"
+	"downloader/internal/ui"
+	"downloader/internal/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+)
+
+// setFromPrompt applies the answer of a prompt and offers to remember it in the config file
+func setFromPrompt(settings *config.Settings, name, value string) {
+	if err := settings.Set(name, value, config.SourcePrompt); err != nil {
+		fail(ExitInputError, err)
+	}
+
+	remember, err := ui.PromptRemember()
+	if err != nil || !remember {
+		return
+	}
+
+	if err := config.Remember(name, value); err != nil {
+		ui.Errorln("Could not remember the choice:", err)
+		return
+	}
+	fmt.Println(color.GreenString("Saved to %s, it won't be asked again.", config.FilePath()))
+}
+
+// missingSettingsError describes the settings that would be asked for when prompts can't be shown,
+// and how to set them
+func missingSettingsError(videoFormat, clipMode bool) error {
+	var missing []string
+	if videoFormat {
+		missing = append(missing, "  -format any|prefer-<container>|force-<container> (or \"format\" in the config file, DOWNLOADER_FORMAT)")
+	}
+	if clipMode {
+		missing = append(missing, "  -clip-mode fast|accurate (or \"clip_mode\" in the config file, DOWNLOADER_CLIP_MODE)")
+	}
+
+	return fmt.Errorf("these settings are needed but can't be asked for because the app is not running interactively:\n%s\nSet them, or add -yes to use the defaults", strings.Join(missing, "\n"))
+}
+
+// runConfig runs "downloader config show", which prints the resolved settings and where each one comes from,
+// "downloader config profiles", which lists the named profiles, and "downloader config import-cookies <file> [name]"
+func runConfig(o *options, args []string) {
+	switch {
+	case len(args) == 1 && args[0] == "show":
+		showSettings(o)
+	case len(args) == 1 && args[0] == "profiles":
+		listProfiles()
+	case (len(args) == 2 || len(args) == 3) && args[0] == "import-cookies":
+		name := ""
+		if len(args) == 3 {
+			name = args[2]
+		}
+		importCookies(args[1], name)
+	default:
+		o.flags.Usage()
+		exit(ExitInputError)
+	}
+}
+
+// showSettings prints the resolved settings and where each one comes from
+func showSettings(o *options) {
+	list := o.loadSettings().List()
+
+	// e.g. the password of the proxy
+	for i := range list {
+		list[i].Value = utils.MaskURLPassword(list[i].Value)
+	}
+
+	if ui.GetOutputMode() == ui.ModeJSON {
+		json.NewEncoder(os.Stdout).Encode(map[string]any{
+			"file":     config.FilePath(),
+			"settings": list,
+		})
+		exit(ExitSuccess)
+	}
+
+	fmt.Println("Config file:", config.FilePath())
+	if dataDir, err := config.DataDir(); err == nil {
+		fmt.Println("App data:   ", dataDir)
+	}
+	if o.profile != "" {
+		fmt.Println("Profile:", o.profile)
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE\tENVIRONMENT\tFLAG")
+	for _, s := range list {
+		flagName := "-"
+		if s.Flag != "" {
+			flagName = "-" + s.Flag
+		}
+		fmt.Fprintf(w, "%s\t%q\t%s\t%s\t%s\n", s.Name, s.Value, s.Source, s.Env, flagName)
+	}
+	w.Flush()
+
+	exit(ExitSuccess)
+}
+
+// importCookies copies the cookie file to the app data directory
+func importCookies(file, name string) {
+	path, err := config.ImportCookieFile(file, name)
+	if err != nil {
+		fail(ExitInputError, err)
+	}
+
+	if ui.GetOutputMode() == ui.ModeJSON {
+		json.NewEncoder(os.Stdout).Encode(map[string]string{"path": path})
+		exit(ExitSuccess)
+	}
+
+	fmt.Println(color.GreenString("Imported the cookies to %s", path))
+	fmt.Printf("Use them with -cookies %s, \"cookies\": %q in the config file or in a site profile.\n", filepath.Base(path), filepath.Base(path))
+	fmt.Println("You can delete the original file, it is readable by other programs.")
+	exit(ExitSuccess)
+}
+
+// listProfiles prints the named profiles of the config file, with the inherited values filled in
+func listProfiles() {
+	profiles, err := config.LoadProfiles()
+	if err != nil {
+		fail(ExitInputError, err)
+	}
+
+	if ui.GetOutputMode() == ui.ModeJSON {
+		json.NewEncoder(os.Stdout).Encode(profiles)
+		exit(ExitSuccess)
+	}
+
+	if len(profiles) == 0 {
+		fmt.Printf("No profiles yet. Add them to the \"profiles\" list of %s.\n", config.FilePath())
+		exit(ExitSuccess)
+	}
+
+	for i, p := range profiles {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		title := color.CyanString(p.Name)
+		if p.Inherits != "" {
+			title += " (inherits " + p.Inherits + ")"
+		}
+		fmt.Println(title)
+		if p.Description != "" {
+			fmt.Println("  " + p.Description)
+		}
+
+		for _, value := range []struct{ name, value string }{
+			{"path", p.Path},
+			{"format", p.Format},
+			{"clip_mode", p.ClipMode},
+			{"encoder", p.Encoder},
+			{"clip_codec", p.ClipCodec},
+			{"audio_format", p.AudioFormat},
+			{"video_template", p.VideoTemplate},
+			{"audio_template", p.AudioTemplate},
+			{"tokens", p.Tokens},
+		} {
+			if value.value != "" {
+				fmt.Printf("  %-15s %s\n", value.name, value.value)
+			}
+		}
+	}
+
+	exit(ExitSuccess)
+}
@@ -9,6 +9,7 @@ require (
 	github.com/fatih/color v1.18.0
 	github.com/gosuri/uiprogress v0.0.1
 	github.com/jaypipes/ghw v0.16.0
+	github.com/mattn/go-isatty v0.0.20
 	github.com/pterm/pterm v0.12.82
 	github.com/ulikunitz/xz v0.5.15
 )
@@ -28,7 +29,6 @@ require (
 	github.com/kballard/go-shellquote v0.0.0-20180428030007-95032a82bc51 // indirect
 	github.com/lithammer/fuzzysearch v1.1.8 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
-	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-runewidth v0.0.19 // indirect
 	github.com/mgutz/ansi v0.0.0-20170206155736-9520e82c474b // indirect
 	github.com/mitchellh/go-homedir v1.1.0 // indirect
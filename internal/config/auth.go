@@ -0,0 +1,163 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// the folder of the app data directory holding the cookie files
+const cookiesDirName = "cookies"
+
+// the credentials file read by yt-dlp --netrc, in the app data directory
+const netrcFileName = ".netrc"
+
+// DataDir returns the directory of the private app data, the cookie files and .netrc:
+// <user config dir>/downloader
+func DataDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find the app data directory: %w", err)
+	}
+	return filepath.Join(dir, "downloader"), nil
+}
+
+// CookiesDir returns the folder of the app data directory holding the cookie files
+func CookiesDir() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, cookiesDirName), nil
+}
+
+// ResolveCookieFile returns the path of a cookie file. A bare file name (e.g. "youtube.txt") is a file
+// of the cookies folder of the app data directory, other paths are used as they are.
+// The file must exist, its permissions are restricted to the user if they are not already.
+func ResolveCookieFile(name string) (string, error) {
+	path := name
+	if filepath.Base(name) == name {
+		dir, err := CookiesDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(dir, name)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("cookie file %s not found (import it with \"downloader config import-cookies <file>\")", path)
+	}
+	if err := restrictPermissions(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// NetrcPath returns the path of the .netrc of the app data directory, "" if there is none
+func NetrcPath() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		// without an app data directory there is no .netrc
+		return "", nil
+	}
+
+	path := filepath.Join(dir, netrcFileName)
+	if _, err := os.Stat(path); err != nil {
+		return "", nil
+	}
+	if err := restrictPermissions(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// ImportCookieFile copies a Netscape cookie file (e.g. exported by a browser extension) to the cookies folder
+// of the app data directory, readable only by the user. name is the file name in the folder, "" keeps the
+// name of the file. It returns the path of the copy.
+func ImportCookieFile(src, name string) (string, error) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return "", fmt.Errorf("cannot read the cookie file: %w", err)
+	}
+	if err := validateCookieFile(data); err != nil {
+		return "", fmt.Errorf("%s is not a Netscape cookie file: %v", src, err)
+	}
+
+	if name == "" {
+		name = filepath.Base(src)
+	}
+	if filepath.Base(name) != name {
+		return "", fmt.Errorf("invalid cookie file name %q (expected a file name without folders)", name)
+	}
+
+	dir, err := CookiesDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("cannot create the cookies folder: %w", err)
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("cannot write the cookie file: %w", err)
+	}
+	// WriteFile keeps the permissions of an existing file
+	if err := restrictPermissions(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// validateCookieFile checks that every line is a comment or a cookie of 7 tab separated fields
+func validateCookieFile(data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1024*1024)
+
+	cookies := 0
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		// the value of a cookie can be empty, so only the line ending is trimmed
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		// "#HttpOnly_" marks the HttpOnly cookies, the other lines starting with # are comments
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "#HttpOnly_") {
+			continue
+		}
+		if len(strings.Split(line, "\t")) != 7 {
+			return fmt.Errorf("line %d is not a cookie (expected 7 fields separated by tabs)", lineNumber)
+		}
+		cookies++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if cookies == 0 {
+		return fmt.Errorf("it has no cookies")
+	}
+	return nil
+}
+
+// restrictPermissions makes the file readable and writable only by its owner.
+// Windows has no such permission bits, the files of the user profile are private there.
+func restrictPermissions(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0077 == 0 {
+		return nil
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		return fmt.Errorf("cannot restrict the permissions of %s: %w", path, err)
+	}
+	return nil
+}
@@ -2,14 +2,12 @@ package config
 
 import (
 	"downloader/internal/models"
+	"downloader/internal/sites"
+	"downloader/internal/ui"
 	"downloader/internal/utils"
-	"flag"
 	"fmt"
 	"os"
-	"os/exec"
-	"strings"
-
-	"github.com/jaypipes/ghw"
+	"time"
 )
 
 type Config struct {
@@ -20,26 +18,130 @@ type Config struct {
 	// the video format to download
 	VideoFormat models.VideoFormat
 
+	// the global codec, frame rate, dynamic range and bitrate preferences (per-line tokens override them)
+	FormatPreferences models.FormatPreferences
+
+	// how audio-only downloads are converted (per-line "audio:<format>" tokens override it)
+	AudioOutput models.AudioOutput
+
 	// if true, the downloader will re-encode clips using the encoder specified in the config
 	ShouldReEncode bool
 
 	// the encoder to use for re-encoding if ShouldUseEncoder is true
 	Encoder string
+
+	// the ffmpeg arguments the encoder needs besides -c:v, e.g. the VAAPI device and upload filter
+	EncoderArgs []string
+
+	// a download is killed and restarted if it produces no output for this long (0 disables the check)
+	StallTimeout time.Duration
+
+	// a download is killed and restarted if it runs longer than this (0 disables the limit)
+	JobTimeout time.Duration
+
+	// how many times a stalled or timed out download is restarted before it is reported as failed
+	StallRestarts int
+
+	// the directory holding one sub directory of job logs per run
+	LogDir string
+
+	// how many run directories are kept in LogDir, older ones are removed (0 keeps all)
+	KeepLogRuns int
+
+	// 0: normal yt-dlp output in the logs, 1: yt-dlp --verbose, 2: --verbose and --print-traffic
+	Verbosity int
+
+	// the site profiles (format strategy, headers, concurrency...) matched by the hostname of the URLs
+	Sites *sites.Registry
+
+	// how many downloads run at the same time, 0 means no limit
+	Concurrency int
+
+	// the yt-dlp output templates, {audio} in AudioTemplate is replaced by the audio format suffix
+	VideoTemplate string
+	AudioTemplate string
+
+	// the Netscape cookie file and the browser the cookies are read from, the site profiles can replace them
+	Cookies            string
+	CookiesFromBrowser string
+
+	// the .netrc of the app data directory holding the site logins, "" if there is none
+	Netrc string
+
+	// the proxy of the downloads, the site profiles can replace it. "" lets yt-dlp use the proxy environment variables.
+	Proxy string
+
+	// the name of the profile the config was created with, "" if none
+	Profile string
+
+	// the configs of the other profiles used by per-line "profile:<name>" tokens, by name
+	Profiles map[string]*Config
+}
+
+// ForRequest returns the config of the request's profile
+func (c *Config) ForRequest(req models.DownloadRequest) *Config {
+	if profileConfig, ok := c.Profiles[req.Profile]; ok {
+		return profileConfig
+	}
+	return c
+}
+
+// the directory holding the download logs and the run summaries
+const DefaultLogDir = "logs"
+
+// Options are the command line options that are not settings. The commands in cmd parse them,
+// the list values (Codecs, AudioLanguages) and audio values are validated by New.
+type Options struct {
+	StallTimeout  time.Duration // restart a download that makes no progress for this long (0 disables the check)
+	JobTimeout    time.Duration // restart a download that runs longer than this (0 means no limit)
+	StallRestarts int           // how many times a stalled download is restarted
+	KeepLogs      int           // how many runs of download logs to keep (0 keeps all)
+	Verbosity     int           // 0: normal yt-dlp output, 1: --verbose, 2: --verbose and --print-traffic
+
+	Codecs         string // preferred video codecs in order, e.g. "h264,vp9"
+	MaxFPS         int    // highest video frame rate (0 means no limit)
+	DynamicRange   string // "sdr", "hdr", "any" or ""
+	MaxBitrate     int    // highest video bitrate in kbps (0 means no limit)
+	AudioLanguages string // preferred audio languages in order, e.g. "ar,en"
+	AllAudioTracks bool   // keep every audio track of videos
+
+	AudioQuality string // a bitrate (e.g. "192k") or VBR quality (q0 to q10) of converted audio
+}
+
+// DefaultOptions returns the options used when none are given on the command line
+func DefaultOptions() Options {
+	return Options{
+		StallTimeout:  10 * time.Minute,
+		StallRestarts: 2,
+		KeepLogs:      10,
+	}
 }
 
-func New(shouldReEncode bool, videoFormat models.VideoFormat) *Config {
+// New creates the config from the resolved settings and the command line options
+func New(settings *Settings, options Options) (*Config, error) {
 
-	downloadPathFlag := flag.String("path", "", "path to the download directory (the default is the current directory)")
+	formatPreferences, err := parseFormatPreferences(options)
+	if err != nil {
+		return nil, err
+	}
+
+	siteRegistry, err := LoadSites()
+	if err != nil {
+		return nil, err
+	}
 
-	flag.Parse()
+	audioOutput, err := parseAudioOutput(settings, options)
+	if err != nil {
+		return nil, err
+	}
 
-	// if the user provides a path flag, the downloaded videos will be saved in that directory. Otherwise, they will be saved in the "Downloads" folder in the current folder.
-	downloadPath := *downloadPathFlag
+	// if the user provides a path, the downloaded videos will be saved in that directory. Otherwise, they will be saved in the "Downloads" folder in the current folder.
+	downloadPath := settings.Path
 
 	if downloadPath == "" {
 		err := os.MkdirAll("Downloads", os.ModePerm)
 		if err != nil {
-			fmt.Printf("Error creating Downloads folder: %v Will use the current folder instead.\n\n", err)
+			ui.Errorln(fmt.Sprintf("Error creating Downloads folder: %v Will use the current folder instead.\n", err))
 			downloadPath = ""
 		} else {
 			downloadPath = "Downloads"
@@ -47,92 +149,132 @@ func New(shouldReEncode bool, videoFormat models.VideoFormat) *Config {
 
 	}
 
-	// If shouldReEncode is true, select the encoder to use based on the GPU.
-	// If the GPU is not detected or the GPU encoder is not working, the CPU encoder will be used.
-	encoder := ""
+	// If clips are re-encoded, select the encoder to use based on the GPUs, unless one is configured.
+	// If no GPU encoder is working, a CPU encoder will be used.
+	shouldReEncode := settings.ClipMode == ClipModeAccurate
+	var encoder encoderCandidate
 
+	// WebM can't hold H.264, so WebM clips are re-encoded to VP9 on the CPU.
 	if shouldReEncode {
-		encoder = selectEncoder()
+		switch {
+		case settings.Encoder != EncoderAuto:
+			encoder = lookupEncoder(settings.Encoder)
+		case settings.VideoFormat.Container == "webm":
+			encoder = lookupEncoder(VP9Encoder)
+		default:
+			encoder = selectEncoder(settings.ClipCodecs)
+		}
 	}
 
-	// create the config
-	cfg := &Config{
-		DownloadPath:   downloadPath,
-		VideoFormat:    videoFormat,
-		Encoder:        encoder,
-		ShouldReEncode: shouldReEncode,
+	// the cookie file and the browser would both fill the cookie jar, and yt-dlp saves the jar
+	// to the file, so the file would be overwritten with the cookies of the browser
+	if settings.Cookies != "" && settings.CookiesFromBrowser != "" {
+		return nil, fmt.Errorf("set cookies or cookies_from_browser, not both")
 	}
 
-	return cfg
-}
+	cookies := ""
+	if settings.Cookies != "" {
+		if cookies, err = ResolveCookieFile(settings.Cookies); err != nil {
+			return nil, err
+		}
+	}
 
-const (
-	// GPU vendors
-	NvidiaGPU = "nvidia"
-	AMDGPU    = "amd"
-	IntelGPU  = "intel"
+	netrc, err := NetrcPath()
+	if err != nil {
+		return nil, err
+	}
 
-	// Default CPU encoder
-	CPUEncoder = "libx264"
-)
+	// create the config
+	cfg := &Config{
+		DownloadPath:       downloadPath,
+		VideoFormat:        settings.VideoFormat,
+		FormatPreferences:  formatPreferences,
+		AudioOutput:        audioOutput,
+		Encoder:            encoder.name,
+		EncoderArgs:        encoder.args,
+		ShouldReEncode:     shouldReEncode,
+		StallTimeout:       options.StallTimeout,
+		JobTimeout:         options.JobTimeout,
+		StallRestarts:      options.StallRestarts,
+		LogDir:             DefaultLogDir,
+		KeepLogRuns:        options.KeepLogs,
+		Verbosity:          options.Verbosity,
+		Sites:              siteRegistry,
+		Concurrency:        settings.Concurrency,
+		VideoTemplate:      settings.VideoTemplate,
+		AudioTemplate:      settings.AudioTemplate,
+		Cookies:            cookies,
+		CookiesFromBrowser: settings.CookiesFromBrowser,
+		Netrc:              netrc,
+		Proxy:              settings.Proxy,
+		Profile:            settings.Profile,
+		Profiles:           make(map[string]*Config),
+	}
 
-// GPUEncoders maps GPU names to their corresponding encoder names
-var GPUEncoders = map[string]string{
-	NvidiaGPU: "h264_nvenc",
-	AMDGPU:    "h264_amf",
-	IntelGPU:  "h264_qsv",
+	return cfg, nil
 }
 
-// Detect the GPU vendor name
-func detectGpu() (string, error) {
+// LoadSites returns the built-in site profiles with the ones of the config file
+func LoadSites() (*sites.Registry, error) {
+	file, err := loadFile(FilePath())
+	if err != nil {
+		return nil, err
+	}
 
-	gpuInfo, err := ghw.GPU()
+	for i, site := range file.Sites {
+		if site.Cookies == "" {
+			continue
+		}
+		if file.Sites[i].Cookies, err = ResolveCookieFile(site.Cookies); err != nil {
+			return nil, fmt.Errorf("site profile %s: %v", site.Name, err)
+		}
+	}
 
+	registry, err := sites.NewRegistry(file.Sites)
 	if err != nil {
-		return "", fmt.Errorf("error getting GPU info: %v", err)
+		return nil, fmt.Errorf("invalid config file %s: %v", FilePath(), err)
 	}
+	return registry, nil
+}
 
-	gpu := ""
-	gpuVendorName := strings.ToLower(gpuInfo.GraphicsCards[0].DeviceInfo.Vendor.Name)
+// parseAudioOutput reads the global audio conversion from the audio_format setting and the options
+func parseAudioOutput(settings *Settings, options Options) (models.AudioOutput, error) {
+	quality, err := utils.ParseAudioQuality(options.AudioQuality)
+	if err != nil {
+		return models.AudioOutput{}, fmt.Errorf("invalid -audio-quality: %v", err)
+	}
 
-	// Check the GPU vendor name and set the GPU variable accordingly
-	switch {
+	return models.AudioOutput{Format: settings.AudioFormat, Quality: quality}, nil
+}
 
-	case strings.Contains(gpuVendorName, "nvidia"):
-		gpu = NvidiaGPU
-	case strings.Contains(gpuVendorName, "amd") || strings.Contains(gpuVendorName, "advanced micro devices"):
-		gpu = AMDGPU
-	case strings.Contains(gpuVendorName, "intel"):
-		gpu = IntelGPU
+// parseFormatPreferences reads the global format preferences from the options
+func parseFormatPreferences(options Options) (models.FormatPreferences, error) {
+	codecs, err := utils.ParseCodecList(options.Codecs)
+	if err != nil {
+		return models.FormatPreferences{}, fmt.Errorf("invalid -codec: %v", err)
 	}
 
-	return gpu, nil
-
-}
+	dynamicRange, err := utils.ParseDynamicRange(options.DynamicRange)
+	if err != nil {
+		return models.FormatPreferences{}, fmt.Errorf("invalid -dynamic-range: %v", err)
+	}
 
-// Test if the GPU encoder is working
-// If the command runs successfully and doesn't return any error, the encoder is working
-func isGpuEncoderWorking(encoder string) bool {
-	testCmd := exec.Command(
-		utils.GetBinaryPath("ffmpeg"),
-		"-hide_banner",
-		"-loglevel", "error",
-		"-f", "lavfi",
-		"-i", "testsrc=duration=1",
-		"-c:v", encoder,
-		"-frames:v", "10",
-		"-f", "null",
-		"-",
-	)
-	return testCmd.Run() == nil
-}
+	audioLanguages, err := utils.ParseLanguageList(options.AudioLanguages)
+	if err != nil {
+		return models.FormatPreferences{}, fmt.Errorf("invalid -audio-lang: %v", err)
+	}
 
-// The encoder will be selected based on the GPU. If the GPU is not detected or the GPU encoder is not working, the CPU encoder will be used.
-func selectEncoder() string {
-	gpu, err := detectGpu()
-	if err != nil || gpu == "" || !isGpuEncoderWorking(GPUEncoders[gpu]) {
-		return CPUEncoder
+	if options.MaxFPS < 0 || options.MaxBitrate < 0 {
+		return models.FormatPreferences{}, fmt.Errorf("-max-fps and -max-bitrate can't be negative")
 	}
 
-	return GPUEncoders[gpu]
+	return models.FormatPreferences{
+		Codecs:       codecs,
+		MaxFPS:       options.MaxFPS,
+		DynamicRange: dynamicRange,
+		MaxBitrate:   options.MaxBitrate,
+
+		AudioLanguages: audioLanguages,
+		AllAudioTracks: options.AllAudioTracks,
+	}, nil
 }
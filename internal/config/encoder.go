@@ -0,0 +1,321 @@
+package config
+
+import (
+	"downloader/internal/dependencies"
+	"downloader/internal/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jaypipes/ghw"
+)
+
+const (
+	// GPU vendors
+	NvidiaGPU = "nvidia"
+	AMDGPU    = "amd"
+	IntelGPU  = "intel"
+
+	// Default CPU encoder
+	CPUEncoder = "libx264"
+
+	// CPU encoder for WebM clips
+	VP9Encoder = "libvpx-vp9"
+)
+
+// the render device used by the VAAPI and Vulkan encoders on Linux
+const renderDevice = "/dev/dri/renderD128"
+
+// the hardware APIs that work with the GPUs of any vendor
+const (
+	apiVAAPI  = "vaapi"
+	apiVulkan = "vulkan"
+)
+
+// encoderCandidate is an ffmpeg encoder that can re-encode clips
+type encoderCandidate struct {
+	name   string   // the ffmpeg encoder, e.g. "hevc_nvenc"
+	codec  string   // "h264", "h265" or "av1"
+	vendor string   // the GPU vendor it needs, "" if it doesn't need a specific one
+	api    string   // apiVAAPI or apiVulkan for the encoders that work with any vendor
+	args   []string // the ffmpeg arguments it needs besides -c:v: the hardware device and the upload filter
+}
+
+// isSoftware returns true if the encoder runs on the CPU
+func (c encoderCandidate) isSoftware() bool {
+	return c.vendor == "" && c.api == ""
+}
+
+var (
+	vaapiArgs  = []string{"-vaapi_device", renderDevice, "-vf", "format=nv12,hwupload"}
+	vulkanArgs = []string{"-init_hw_device", "vulkan=vk", "-filter_hw_device", "vk", "-vf", "format=nv12,hwupload"}
+)
+
+// encoderCandidates lists the encoders of each codec in the order they are tried, the GPU encoders first
+var encoderCandidates = []encoderCandidate{
+	{name: "h264_nvenc", codec: "h264", vendor: NvidiaGPU},
+	{name: "h264_qsv", codec: "h264", vendor: IntelGPU},
+	{name: "h264_amf", codec: "h264", vendor: AMDGPU},
+	{name: "h264_vaapi", codec: "h264", api: apiVAAPI, args: vaapiArgs},
+	{name: "h264_vulkan", codec: "h264", api: apiVulkan, args: vulkanArgs},
+	{name: "libx264", codec: "h264"},
+
+	{name: "hevc_nvenc", codec: "h265", vendor: NvidiaGPU},
+	{name: "hevc_qsv", codec: "h265", vendor: IntelGPU},
+	{name: "hevc_amf", codec: "h265", vendor: AMDGPU},
+	{name: "hevc_vaapi", codec: "h265", api: apiVAAPI, args: vaapiArgs},
+	{name: "hevc_vulkan", codec: "h265", api: apiVulkan, args: vulkanArgs},
+	{name: "libx265", codec: "h265"},
+
+	{name: "libsvtav1", codec: "av1"},
+}
+
+// the codecs of the encoders, the values of the clip_codec setting
+var encoderCodecs = []string{"h264", "h265", "av1"}
+
+// parseClipCodecs parses the clip_codec setting: the codecs of accurate clips in order, e.g. "h265,h264"
+func parseClipCodecs(value string) ([]string, error) {
+	list, err := utils.ParseCodecList(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var codecs []string
+	for _, codec := range list {
+		if !slices.Contains(encoderCodecs, codec) {
+			return nil, fmt.Errorf("clips can't be encoded to %s (expected h264, h265 or av1)", codec)
+		}
+		if !slices.Contains(codecs, codec) {
+			codecs = append(codecs, codec)
+		}
+	}
+
+	if len(codecs) == 0 {
+		return nil, fmt.Errorf("no codec (expected e.g. h264 or h265,h264)")
+	}
+	return codecs, nil
+}
+
+// lookupEncoder returns the candidate with the name, or an encoder without extra arguments if it isn't one of them
+func lookupEncoder(name string) encoderCandidate {
+	for _, c := range encoderCandidates {
+		if c.name == name {
+			return c
+		}
+	}
+	return encoderCandidate{name: name}
+}
+
+// IsSoftwareEncoder returns true if the encoder is one of the known CPU encoders
+func IsSoftwareEncoder(name string) bool {
+	for _, c := range encoderCandidates {
+		if c.name == name {
+			return c.isSoftware()
+		}
+	}
+	return name == VP9Encoder
+}
+
+// EncoderCodec returns the codec the encoder produces ("h264", "h265", "av1", "vp9" or "vp8"),
+// from the known candidates or else from its name, e.g. "hevc_videotoolbox". It is "" if it can't be told.
+func EncoderCodec(name string) string {
+	if c := lookupEncoder(name); c.codec != "" {
+		return c.codec
+	}
+
+	lower := strings.ToLower(name)
+	switch {
+	case strings.Contains(lower, "264"):
+		return "h264"
+	case strings.Contains(lower, "265") || strings.Contains(lower, "hevc"):
+		return "h265"
+	case strings.Contains(lower, "av1"):
+		return "av1"
+	case strings.Contains(lower, "vp9"):
+		return "vp9"
+	case strings.Contains(lower, "vp8"):
+		return "vp8"
+	}
+	return ""
+}
+
+// detectGPUVendors returns the vendors of all the graphics cards, without duplicates
+func detectGPUVendors() []string {
+	gpuInfo, err := ghw.GPU(ghw.WithDisableWarnings())
+	if err != nil {
+		return nil
+	}
+
+	var vendors []string
+	for _, card := range gpuInfo.GraphicsCards {
+		if card == nil || card.DeviceInfo == nil || card.DeviceInfo.Vendor == nil {
+			continue
+		}
+
+		vendor := ""
+		vendorName := strings.ToLower(card.DeviceInfo.Vendor.Name)
+
+		switch {
+		case strings.Contains(vendorName, "nvidia"):
+			vendor = NvidiaGPU
+		case strings.Contains(vendorName, "amd") || strings.Contains(vendorName, "advanced micro devices"):
+			vendor = AMDGPU
+		case strings.Contains(vendorName, "intel"):
+			vendor = IntelGPU
+		}
+
+		if vendor != "" && !slices.Contains(vendors, vendor) {
+			vendors = append(vendors, vendor)
+		}
+	}
+	return vendors
+}
+
+// rankEncoders returns the candidates of the codecs that can work with the GPU vendors, in the order they are tried:
+// the GPU encoders of every codec first, in the order of the codecs, then their CPU encoders.
+func rankEncoders(vendors []string, codecs []string) []encoderCandidate {
+	_, err := os.Stat(renderDevice)
+	hasRenderDevice := runtime.GOOS == "linux" && err == nil
+
+	var gpu, cpu []encoderCandidate
+	for _, codec := range codecs {
+		for _, c := range encoderCandidates {
+			switch {
+			case c.codec != codec:
+				continue
+			case c.isSoftware():
+				cpu = append(cpu, c)
+				continue
+			case c.vendor != "" && !slices.Contains(vendors, c.vendor):
+				continue
+			case c.api == apiVAAPI && !hasRenderDevice:
+				continue
+			case c.api == apiVulkan && len(vendors) == 0:
+				continue
+			}
+			gpu = append(gpu, c)
+		}
+	}
+	return append(gpu, cpu...)
+}
+
+// Test if the encoder is working
+// If the command runs successfully and doesn't return any error, the encoder is working
+func isEncoderWorking(c encoderCandidate) bool {
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-f", "lavfi",
+		"-i", "testsrc=duration=1",
+	}
+	args = append(args, c.args...)
+	args = append(args,
+		"-c:v", c.name,
+		"-frames:v", "10",
+		"-f", "null",
+		"-",
+	)
+
+	testCmd := exec.Command(dependencies.BinaryPath("ffmpeg"), args...)
+	return testCmd.Run() == nil
+}
+
+// encoderCache is the result of the last encoder probe. It is used while the candidates and ffmpeg don't change.
+type encoderCache struct {
+	Candidates []string  `json:"candidates"` // the ranked candidates that were probed
+	FFmpeg     string    `json:"ffmpeg"`     // the path, size and modification time of ffmpeg
+	Encoder    string    `json:"encoder"`    // the first working candidate
+	Probed     time.Time `json:"probed"`
+}
+
+// the probe is done again after this long, e.g. to notice new drivers
+const encoderCacheMaxAge = 30 * 24 * time.Hour
+
+// encoderCachePath returns the path of the encoder cache in the user cache folder, "" if there is none
+func encoderCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "downloader", "encoder.json")
+}
+
+// ffmpegFingerprint identifies the installed ffmpeg, it changes when ffmpeg is updated
+func ffmpegFingerprint() string {
+	path := dependencies.BinaryPath("ffmpeg")
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s %d %d", path, info.Size(), info.ModTime().Unix())
+}
+
+func loadEncoderCache(path string) (*encoderCache, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var cache encoderCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, false
+	}
+	return &cache, true
+}
+
+func saveEncoderCache(path string, cache *encoderCache) {
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	os.WriteFile(path, data, 0644)
+}
+
+// selectEncoder returns the first working encoder of the clip codecs, ranked for the GPUs of this computer.
+// The result is cached between runs. If no candidate works, the CPU encoder is used.
+func selectEncoder(codecs []string) encoderCandidate {
+	ranked := rankEncoders(detectGPUVendors(), codecs)
+
+	names := make([]string, len(ranked))
+	for i, c := range ranked {
+		names[i] = c.name
+	}
+
+	cachePath := encoderCachePath()
+	fingerprint := ffmpegFingerprint()
+
+	if cache, ok := loadEncoderCache(cachePath); ok &&
+		slices.Equal(cache.Candidates, names) &&
+		cache.FFmpeg == fingerprint &&
+		time.Since(cache.Probed) < encoderCacheMaxAge {
+		return lookupEncoder(cache.Encoder)
+	}
+
+	selected := lookupEncoder(CPUEncoder)
+	for _, c := range ranked {
+		if isEncoderWorking(c) {
+			selected = c
+			break
+		}
+	}
+
+	if cachePath != "" && fingerprint != "" {
+		saveEncoderCache(cachePath, &encoderCache{
+			Candidates: names,
+			FFmpeg:     fingerprint,
+			Encoder:    selected.name,
+			Probed:     time.Now(),
+		})
+	}
+
+	return selected
+}
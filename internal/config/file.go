@@ -0,0 +1,88 @@
+package config
+
+import (
+	"downloader/internal/sites"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// the name of the config file, looked up in the current folder and then in the user config directory
+const configFileName = "config.json"
+
+// File is the content of the config file. Empty values are not set, see Settings for their meaning.
+type File struct {
+	Path          string `json:"path,omitempty"`
+	Format        string `json:"format,omitempty"`
+	ClipMode      string `json:"clip_mode,omitempty"`
+	Encoder       string `json:"encoder,omitempty"`
+	ClipCodec     string `json:"clip_codec,omitempty"`
+	AudioFormat   string `json:"audio_format,omitempty"`
+	Concurrency   int    `json:"concurrency,omitempty"`
+	VideoTemplate string `json:"video_template,omitempty"`
+	AudioTemplate string `json:"audio_template,omitempty"`
+
+	Cookies            string `json:"cookies,omitempty"`
+	CookiesFromBrowser string `json:"cookies_from_browser,omitempty"`
+	Proxy              string `json:"proxy,omitempty"`
+	YtDlpVersion       string `json:"ytdlp_version,omitempty"`
+	UpdateInterval     string `json:"update_interval,omitempty"`
+	YtDlpPath          string `json:"ytdlp_path,omitempty"`
+	FFmpegPath         string `json:"ffmpeg_path,omitempty"`
+	DenoPath           string `json:"deno_path,omitempty"`
+
+	// site profiles, they are matched before the built-in ones and replace those with the same name
+	Sites []sites.Profile `json:"sites,omitempty"`
+
+	// named profiles, selected with -profile or a per-line "profile:<name>" token
+	Profiles []Profile `json:"profiles,omitempty"`
+}
+
+// FilePath returns the path of the config file: config.json in the current folder if it exists,
+// otherwise <user config dir>/downloader/config.json
+func FilePath() string {
+	if _, err := os.Stat(configFileName); err == nil {
+		return configFileName
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return configFileName
+	}
+	return filepath.Join(dir, "downloader", configFileName)
+}
+
+// loadFile reads the config file, a missing file is the same as an empty one
+func loadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &File{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the config file: %w", err)
+	}
+
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	return &file, nil
+}
+
+// saveFile writes the config file, creating its directory if needed
+func saveFile(path string, file *File) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("cannot create the config directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot write the config file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"downloader/internal/models"
+	"downloader/internal/utils"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Profile is a named bundle of settings and line tokens for a recurring kind of job (e.g. "podcast" or "archive").
+// It is selected with -profile or a per-line "profile:<name>" token. Empty values are inherited from the
+// profile named in Inherits, or keep the global setting.
+type Profile struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Inherits    string `json:"inherits,omitempty"`
+
+	Path          string `json:"path,omitempty"`
+	Format        string `json:"format,omitempty"`
+	ClipMode      string `json:"clip_mode,omitempty"`
+	Encoder       string `json:"encoder,omitempty"`
+	ClipCodec     string `json:"clip_codec,omitempty"`
+	AudioFormat   string `json:"audio_format,omitempty"`
+	VideoTemplate string `json:"video_template,omitempty"`
+	AudioTemplate string `json:"audio_template,omitempty"`
+
+	// words added to every line that uses the profile, as written on a line of urls.txt
+	// (e.g. "audio:mp3@128k" or "720p h264"), the words of the line override them
+	Tokens string `json:"tokens,omitempty"`
+}
+
+var profileNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// LoadProfiles returns the profiles of the config file in their order, with the inherited values filled in
+func LoadProfiles() ([]*Profile, error) {
+	file, err := loadFile(FilePath())
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := resolveProfiles(file.Profiles)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", FilePath(), err)
+	}
+	return profiles, nil
+}
+
+// FindProfile returns the profile with the name
+func FindProfile(profiles []*Profile, name string) (*Profile, error) {
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown profile %q (run \"downloader config profiles\" to list them)", name)
+}
+
+// resolveProfiles validates the profiles and fills in the values inherited from their parents
+func resolveProfiles(list []Profile) ([]*Profile, error) {
+	byName := make(map[string]*Profile)
+	for i := range list {
+		p := &list[i]
+		if !profileNameRegex.MatchString(p.Name) {
+			return nil, fmt.Errorf("invalid profile name %q (use lowercase letters, digits, - and _)", p.Name)
+		}
+		if byName[p.Name] != nil {
+			return nil, fmt.Errorf("profile %q is defined twice", p.Name)
+		}
+		byName[p.Name] = p
+	}
+
+	resolved := make(map[string]*Profile)
+
+	// resolve follows the inheritance chain, visiting holds the profiles of the chain to detect loops
+	var resolve func(name string, visiting []string) (*Profile, error)
+	resolve = func(name string, visiting []string) (*Profile, error) {
+		if p, ok := resolved[name]; ok {
+			return p, nil
+		}
+
+		for _, v := range visiting {
+			if v == name {
+				return nil, fmt.Errorf("profiles inherit from each other in a loop: %s", strings.Join(append(visiting, name), " -> "))
+			}
+		}
+
+		p := *byName[name]
+		if p.Inherits != "" {
+			if byName[p.Inherits] == nil {
+				return nil, fmt.Errorf("profile %q inherits from unknown profile %q", p.Name, p.Inherits)
+			}
+			parent, err := resolve(p.Inherits, append(visiting, name))
+			if err != nil {
+				return nil, err
+			}
+			p.inherit(parent)
+		}
+
+		resolved[name] = &p
+		return &p, nil
+	}
+
+	profiles := make([]*Profile, len(list))
+	for i := range list {
+		p, err := resolve(list[i].Name, nil)
+		if err != nil {
+			return nil, err
+		}
+		profiles[i] = p
+	}
+	return profiles, nil
+}
+
+// inherit fills in the empty values from the parent, the tokens of the parent come first so the profile's own override them
+func (p *Profile) inherit(parent *Profile) {
+	inheritValue := func(value *string, parentValue string) {
+		if *value == "" {
+			*value = parentValue
+		}
+	}
+	inheritValue(&p.Path, parent.Path)
+	inheritValue(&p.Format, parent.Format)
+	inheritValue(&p.ClipMode, parent.ClipMode)
+	inheritValue(&p.Encoder, parent.Encoder)
+	inheritValue(&p.ClipCodec, parent.ClipCodec)
+	inheritValue(&p.AudioFormat, parent.AudioFormat)
+	inheritValue(&p.VideoTemplate, parent.VideoTemplate)
+	inheritValue(&p.AudioTemplate, parent.AudioTemplate)
+
+	p.Tokens = strings.TrimSpace(parent.Tokens + " " + p.Tokens)
+}
+
+// ApplyTokens returns the request with the tokens of the profile added. The values set on the line are kept:
+// "audio" in the profile only makes the line an audio download if the line sets no video quality or preferences.
+func (p *Profile) ApplyTokens(req models.DownloadRequest) models.DownloadRequest {
+	if p.Tokens == "" {
+		return req
+	}
+
+	defaults := utils.ParseDownloadRequest(req.Url + " " + p.Tokens)
+
+	// a line asking for a video keeps it, otherwise like on a line, audio ignores the quality and video preferences
+	if defaults.IsAudioOnly && !req.IsAudioOnly && !req.Quality.IsSet() && !req.Preferences.HasVideoPreferences() {
+		req.IsAudioOnly = true
+		req.Quality = models.Quality{}
+		req.Preferences = models.FormatPreferences{AudioLanguages: req.Preferences.AudioLanguages}
+	}
+	if !req.IsAudioOnly && !req.Quality.IsSet() {
+		req.Quality = defaults.Quality
+	}
+
+	req.Preferences = defaults.Preferences.WithOverrides(req.Preferences)
+	req.AudioOutput = defaults.AudioOutput.WithOverrides(req.AudioOutput)
+	req.UnknownTokens = append(req.UnknownTokens, defaults.UnknownTokens...)
+
+	return req
+}
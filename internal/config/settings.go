@@ -0,0 +1,449 @@
+package config
+
+import (
+	"downloader/internal/dependencies"
+	"downloader/internal/models"
+	"downloader/internal/sites"
+	"downloader/internal/utils"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Source is where the value of a setting comes from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "config file"
+	SourceProfile Source = "profile"
+	SourceEnv     Source = "environment"
+	SourceFlag    Source = "flag"
+	SourcePrompt  Source = "prompt"
+)
+
+// Clip modes
+const (
+	ClipModeFast     = "fast"     // cut at the nearest keyframes without re-encoding
+	ClipModeAccurate = "accurate" // re-encode to cut at the exact times
+)
+
+// the encoder setting value that detects the best working encoder
+const EncoderAuto = "auto"
+
+// the output templates, {audio} is replaced by the audio format suffix (e.g. "audio-mp3-192k")
+const (
+	DefaultVideoTemplate = "%(title).150s-%(height)sp.%(ext)s"
+	DefaultAudioTemplate = "%(title).150s-{audio}.%(ext)s"
+)
+
+// Settings are the defaults that can be remembered in the config file and overridden
+// by environment variables and flags
+type Settings struct {
+	Path          string             // the download directory, "" for the Downloads folder
+	VideoFormat   models.VideoFormat // the container of video downloads
+	ClipMode      string             // ClipModeFast or ClipModeAccurate
+	Encoder       string             // the encoder of accurate clips, or EncoderAuto
+	ClipCodecs    []string           // the codecs of accurate clips in order, EncoderAuto tries their encoders
+	AudioFormat   string             // the yt-dlp --audio-format of audio downloads, "" keeps the original format
+	Concurrency   int                // how many downloads run at the same time, 0 means no limit
+	VideoTemplate string             // the yt-dlp output template of videos
+	AudioTemplate string             // the yt-dlp output template of audio downloads
+	Profile       string             // the name of the applied profile, "" if none
+
+	Cookies            string // the Netscape cookie file, a bare file name is in the cookies folder of the app data directory
+	CookiesFromBrowser string // the browser the cookies are read from, e.g. "firefox" or "chrome:Profile 1"
+	Proxy              string // the proxy of the downloads and dependency fetching, "" uses the proxy environment variables
+
+	YtDlp          dependencies.YtDlpTarget // the yt-dlp release channel or pinned version
+	UpdateInterval time.Duration            // how long the latest yt-dlp release is remembered, 0 looks it up on every run
+
+	// the paths of the programs, by program ("yt-dlp", "ffmpeg" or "deno"). The programs without a path
+	// are looked for in the bin directory and then in PATH.
+	BinaryPaths map[string]string
+
+	values  map[string]string
+	sources map[string]Source
+}
+
+// settingDef describes a setting: where it is read from and how it is applied
+type settingDef struct {
+	name         string // the key in the config file
+	env          string // the environment variable, "" if none
+	flag         string // the flag, "" if none
+	usage        string // the help text of the flag
+	defaultValue string
+
+	fromFile    func(f *File) string    // the value in the file, "" if not set
+	fromProfile func(p *Profile) string // the value in a profile, nil if profiles can't set it
+	toFile      func(f *File, value string)
+	apply       func(s *Settings, value string) error
+}
+
+// settingDefs lists the settings in the order of "config show"
+var settingDefs = []settingDef{
+	{
+		name: "path", env: "DOWNLOADER_PATH", flag: "path",
+		usage:       "path to the download directory (default: the Downloads folder)",
+		fromFile:    func(f *File) string { return f.Path },
+		fromProfile: func(p *Profile) string { return p.Path },
+		toFile:      func(f *File, value string) { f.Path = value },
+		apply: func(s *Settings, value string) error {
+			s.Path = value
+			return nil
+		},
+	},
+	{
+		name: "format", env: "DOWNLOADER_FORMAT", flag: "format", defaultValue: models.FormatAny.String(),
+		usage:       "video format: any, prefer-<container> or force-<container> with mp4, mkv, webm or mov",
+		fromFile:    func(f *File) string { return f.Format },
+		fromProfile: func(p *Profile) string { return p.Format },
+		toFile:      func(f *File, value string) { f.Format = value },
+		apply: func(s *Settings, value string) (err error) {
+			s.VideoFormat, err = utils.ParseVideoFormat(value)
+			return err
+		},
+	},
+	{
+		name: "clip_mode", env: "DOWNLOADER_CLIP_MODE", flag: "clip-mode", defaultValue: ClipModeFast,
+		usage:       "how clips are cut: fast (nearest keyframes) or accurate (re-encode)",
+		fromFile:    func(f *File) string { return f.ClipMode },
+		fromProfile: func(p *Profile) string { return p.ClipMode },
+		toFile:      func(f *File, value string) { f.ClipMode = value },
+		apply: func(s *Settings, value string) error {
+			if value != ClipModeFast && value != ClipModeAccurate {
+				return fmt.Errorf("unknown clip mode %q (expected %s or %s)", value, ClipModeFast, ClipModeAccurate)
+			}
+			s.ClipMode = value
+			return nil
+		},
+	},
+	{
+		name: "encoder", env: "DOWNLOADER_ENCODER", flag: "encoder", defaultValue: EncoderAuto,
+		usage:       "ffmpeg encoder of accurate clips, e.g. h264_nvenc (auto detects the best working encoder)",
+		fromFile:    func(f *File) string { return f.Encoder },
+		fromProfile: func(p *Profile) string { return p.Encoder },
+		toFile:      func(f *File, value string) { f.Encoder = value },
+		apply: func(s *Settings, value string) error {
+			s.Encoder = value
+			return nil
+		},
+	},
+	{
+		name: "clip_codec", env: "DOWNLOADER_CLIP_CODEC", flag: "clip-codec", defaultValue: "h264",
+		usage:       "codecs of accurate clips in order of preference, e.g. h265,h264 (h264, h265/hevc or av1), the auto encoder tries their GPU encoders first",
+		fromFile:    func(f *File) string { return f.ClipCodec },
+		fromProfile: func(p *Profile) string { return p.ClipCodec },
+		toFile:      func(f *File, value string) { f.ClipCodec = value },
+		apply: func(s *Settings, value string) (err error) {
+			s.ClipCodecs, err = parseClipCodecs(value)
+			return err
+		},
+	},
+	{
+		name: "audio_format", env: "DOWNLOADER_AUDIO_FORMAT", flag: "audio-format", defaultValue: "original",
+		usage:       "format audio downloads are converted to: mp3, m4a, opus, flac, wav or original (no conversion)",
+		fromFile:    func(f *File) string { return f.AudioFormat },
+		fromProfile: func(p *Profile) string { return p.AudioFormat },
+		toFile:      func(f *File, value string) { f.AudioFormat = value },
+		apply: func(s *Settings, value string) (err error) {
+			s.AudioFormat, err = utils.ParseAudioFormat(value)
+			return err
+		},
+	},
+	{
+		name: "concurrency", env: "DOWNLOADER_CONCURRENCY", flag: "concurrency", defaultValue: "0",
+		usage: "how many downloads run at the same time (0 means no limit)",
+		fromFile: func(f *File) string {
+			if f.Concurrency == 0 {
+				return ""
+			}
+			return strconv.Itoa(f.Concurrency)
+		},
+		toFile: func(f *File, value string) { f.Concurrency, _ = strconv.Atoi(value) },
+		apply: func(s *Settings, value string) error {
+			concurrency, err := strconv.Atoi(value)
+			if err != nil || concurrency < 0 {
+				return fmt.Errorf("invalid concurrency %q (expected 0 or more)", value)
+			}
+			s.Concurrency = concurrency
+			return nil
+		},
+	},
+	{
+		name: "video_template", env: "DOWNLOADER_VIDEO_TEMPLATE", flag: "video-template", defaultValue: DefaultVideoTemplate,
+		usage:       "yt-dlp output template of videos",
+		fromFile:    func(f *File) string { return f.VideoTemplate },
+		fromProfile: func(p *Profile) string { return p.VideoTemplate },
+		toFile:      func(f *File, value string) { f.VideoTemplate = value },
+		apply: func(s *Settings, value string) error {
+			s.VideoTemplate = value
+			return nil
+		},
+	},
+	{
+		name: "audio_template", env: "DOWNLOADER_AUDIO_TEMPLATE", flag: "audio-template", defaultValue: DefaultAudioTemplate,
+		usage:       "yt-dlp output template of audio downloads, {audio} is replaced by the audio format",
+		fromFile:    func(f *File) string { return f.AudioTemplate },
+		fromProfile: func(p *Profile) string { return p.AudioTemplate },
+		toFile:      func(f *File, value string) { f.AudioTemplate = value },
+		apply: func(s *Settings, value string) error {
+			s.AudioTemplate = value
+			return nil
+		},
+	},
+	{
+		name: "cookies", env: "DOWNLOADER_COOKIES", flag: "cookies",
+		usage:    "Netscape cookie file for members-only and age-restricted videos, a bare file name is looked up in the cookies folder of the app data directory",
+		fromFile: func(f *File) string { return f.Cookies },
+		toFile:   func(f *File, value string) { f.Cookies = value },
+		apply: func(s *Settings, value string) error {
+			s.Cookies = value
+			return nil
+		},
+	},
+	{
+		name: "cookies_from_browser", env: "DOWNLOADER_COOKIES_FROM_BROWSER", flag: "cookies-from-browser",
+		usage:    "read the cookies from a browser profile: BROWSER[+KEYRING][:PROFILE][::CONTAINER], e.g. firefox or \"chrome:Profile 1\"",
+		fromFile: func(f *File) string { return f.CookiesFromBrowser },
+		toFile:   func(f *File, value string) { f.CookiesFromBrowser = value },
+		apply: func(s *Settings, value string) error {
+			if value != "" {
+				if err := sites.ValidateBrowser(value); err != nil {
+					return err
+				}
+			}
+			s.CookiesFromBrowser = value
+			return nil
+		},
+	},
+	{
+		name: "proxy", env: "DOWNLOADER_PROXY", flag: "proxy",
+		usage:    "proxy of the downloads and of the yt-dlp, ffmpeg and deno downloads: http://, https://, socks5:// or socks5h://host:port, or direct (default: the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables)",
+		fromFile: func(f *File) string { return f.Proxy },
+		toFile:   func(f *File, value string) { f.Proxy = value },
+		apply: func(s *Settings, value string) error {
+			if value != "" {
+				if err := utils.ValidateProxy(value); err != nil {
+					return err
+				}
+			}
+			s.Proxy = value
+			return nil
+		},
+	},
+	{
+		name: "ytdlp_version", env: "DOWNLOADER_YTDLP_VERSION", flag: "ytdlp-version", defaultValue: dependencies.ChannelStable,
+		usage:    "yt-dlp release channel (stable, nightly or master) or pinned version (e.g. 2025.01.15 or nightly@2025.01.16.232854)",
+		fromFile: func(f *File) string { return f.YtDlpVersion },
+		toFile:   func(f *File, value string) { f.YtDlpVersion = value },
+		apply: func(s *Settings, value string) (err error) {
+			s.YtDlp, err = dependencies.ParseYtDlpTarget(value)
+			return err
+		},
+	},
+	{
+		name: "update_interval", env: "DOWNLOADER_UPDATE_INTERVAL", flag: "update-interval", defaultValue: "24h",
+		usage:    "how often to look for a new yt-dlp release, e.g. 12h or 7d (0 looks on every run)",
+		fromFile: func(f *File) string { return f.UpdateInterval },
+		toFile:   func(f *File, value string) { f.UpdateInterval = value },
+		apply: func(s *Settings, value string) (err error) {
+			s.UpdateInterval, err = dependencies.ParseUpdateInterval(value)
+			return err
+		},
+	},
+	binaryPathSetting("yt-dlp", "ytdlp_path", "DOWNLOADER_YTDLP_PATH", "ytdlp-path",
+		func(f *File) *string { return &f.YtDlpPath }),
+	binaryPathSetting("ffmpeg", "ffmpeg_path", "DOWNLOADER_FFMPEG_PATH", "ffmpeg-path",
+		func(f *File) *string { return &f.FFmpegPath }),
+	binaryPathSetting("deno", "deno_path", "DOWNLOADER_DENO_PATH", "deno-path",
+		func(f *File) *string { return &f.DenoPath }),
+}
+
+// binaryPathSetting describes the setting of the path of a program. Relative paths are made absolute,
+// from the working directory.
+func binaryPathSetting(program, name, env, flag string, field func(f *File) *string) settingDef {
+	return settingDef{
+		name: name, env: env, flag: flag,
+		usage:    fmt.Sprintf("path of the %s program to use, instead of looking for it in the bin folder and PATH", program),
+		fromFile: func(f *File) string { return *field(f) },
+		toFile:   func(f *File, value string) { *field(f) = value },
+		apply: func(s *Settings, value string) error {
+			if s.BinaryPaths == nil {
+				s.BinaryPaths = make(map[string]string)
+			}
+			if value == "" {
+				delete(s.BinaryPaths, program)
+				return nil
+			}
+			abs, err := filepath.Abs(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s path %q: %v", program, value, err)
+			}
+			s.BinaryPaths[program] = abs
+			return nil
+		},
+	}
+}
+
+func findSettingDef(name string) (settingDef, bool) {
+	for _, def := range settingDefs {
+		if def.name == name {
+			return def, true
+		}
+	}
+	return settingDef{}, false
+}
+
+// SettingFlag describes the command line flag of a setting
+type SettingFlag struct {
+	Name         string // the setting
+	Flag         string
+	Usage        string
+	DefaultValue string
+}
+
+// SettingFlags returns the settings that can be given as flags
+func SettingFlags() []SettingFlag {
+	var flags []SettingFlag
+	for _, def := range settingDefs {
+		if def.flag != "" {
+			flags = append(flags, SettingFlag{Name: def.name, Flag: def.flag, Usage: def.usage, DefaultValue: def.defaultValue})
+		}
+	}
+	return flags
+}
+
+// LoadSettings resolves the settings. Each value comes from the first source that sets it, in this order:
+// flags, environment variables, the profile (if not nil), the config file and the defaults.
+// flagValues holds the values of the setting flags given on the command line, by flag name.
+func LoadSettings(flagValues map[string]string, profile *Profile) (*Settings, error) {
+	file, err := loadFile(FilePath())
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Settings{
+		values:  make(map[string]string),
+		sources: make(map[string]Source),
+	}
+
+	for _, def := range settingDefs {
+		value, source := def.defaultValue, SourceDefault
+
+		if v := def.fromFile(file); v != "" {
+			value, source = v, SourceFile
+		}
+		if profile != nil && def.fromProfile != nil {
+			if v := def.fromProfile(profile); v != "" {
+				value, source = v, SourceProfile
+			}
+		}
+		if v := os.Getenv(def.env); def.env != "" && v != "" {
+			value, source = v, SourceEnv
+		}
+		if v, ok := flagValues[def.flag]; def.flag != "" && ok {
+			value, source = v, SourceFlag
+		}
+
+		if err := s.set(def, value, source); err != nil {
+			return nil, err
+		}
+	}
+
+	if profile != nil {
+		s.Profile = profile.Name
+	}
+
+	return s, nil
+}
+
+// WithProfile returns a copy of the settings with the values of the profile applied over all the others,
+// it is used for the lines with a "profile:<name>" token
+func (s *Settings) WithProfile(profile *Profile) (*Settings, error) {
+	c := *s
+	c.Profile = profile.Name
+	c.values = maps.Clone(s.values)
+	c.sources = maps.Clone(s.sources)
+
+	for _, def := range settingDefs {
+		if def.fromProfile == nil {
+			continue
+		}
+		if v := def.fromProfile(profile); v != "" {
+			if err := c.set(def, v, SourceProfile); err != nil {
+				return nil, fmt.Errorf("profile %q: %v", profile.Name, err)
+			}
+		}
+	}
+
+	return &c, nil
+}
+
+// Set changes a setting, e.g. to the answer of a prompt
+func (s *Settings) Set(name, value string, source Source) error {
+	def, ok := findSettingDef(name)
+	if !ok {
+		return fmt.Errorf("unknown setting %q", name)
+	}
+	return s.set(def, value, source)
+}
+
+func (s *Settings) set(def settingDef, value string, source Source) error {
+	if err := def.apply(s, value); err != nil {
+		return fmt.Errorf("invalid %s (from %s): %v", def.name, source, err)
+	}
+	s.values[def.name] = value
+	s.sources[def.name] = source
+	return nil
+}
+
+// IsSet returns true if the setting doesn't have its default value,
+// a prompt is only needed for the settings that are not set
+func (s *Settings) IsSet(name string) bool {
+	return s.sources[name] != SourceDefault
+}
+
+// SettingValue is a resolved setting, as shown by "config show"
+type SettingValue struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source Source `json:"source"`
+	Env    string `json:"env,omitempty"`
+	Flag   string `json:"flag,omitempty"`
+}
+
+// List returns the resolved settings with their source
+func (s *Settings) List() []SettingValue {
+	list := make([]SettingValue, len(settingDefs))
+	for i, def := range settingDefs {
+		list[i] = SettingValue{
+			Name:   def.name,
+			Value:  s.values[def.name],
+			Source: s.sources[def.name],
+			Env:    def.env,
+			Flag:   def.flag,
+		}
+	}
+	return list
+}
+
+// Remember saves the setting in the config file, so it is used by the next runs
+func Remember(name, value string) error {
+	def, ok := findSettingDef(name)
+	if !ok {
+		return fmt.Errorf("unknown setting %q", name)
+	}
+
+	path := FilePath()
+	file, err := loadFile(path)
+	if err != nil {
+		return err
+	}
+
+	def.toFile(file, value)
+	return saveFile(path, file)
+}
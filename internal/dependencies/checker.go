@@ -1,73 +1,64 @@
 package dependencies
 
 import (
-	"downloader/internal/utils"
 	"encoding/json"
-	"net/http"
-	"os"
-	"os/exec"
-	"strings"
+	"fmt"
+	"time"
 )
 
-// programExists checks if a program exists in the bin directory
-func programExists(programName string) bool {
-	entries, err := os.ReadDir("bin")
-	if err != nil {
-		return false
-	}
+// Programs are the external programs the app needs, they are installed in the bin directory when they are not found
+var Programs = []string{"yt-dlp", "ffmpeg", "deno"}
 
-	searchName := strings.ToLower(programName)
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		if strings.Contains(strings.ToLower(entry.Name()), searchName) {
-			return true
-		}
+// ProgramVersion returns the version of the program ResolveBinary finds, e.g. "2025.01.01" for yt-dlp
+func ProgramVersion(program string) (string, error) {
+	binary, err := ResolveBinary(program)
+	if err != nil {
+		return "", err
 	}
-	return false
+	return binary.Version, nil
 }
 
-// getLatestYtDlpVersion gets the latest yt-dlp version tag from GitHub releases
-func getLatestYtDlpVersion() (string, error) {
-	resp, err := http.Get("https://api.github.com/repos/yt-dlp/yt-dlp/releases/latest")
+// getLatestYtDlpVersion gets the latest yt-dlp version tag from the GitHub releases of the repository of a channel
+func getLatestYtDlpVersion(repo string) (string, error) {
+	resp, err := getHTTPClient().Get("https://api.github.com/repos/" + repo + "/releases/latest")
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
+	// e.g. 403 when the rate limit of the GitHub API is reached
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
+	}
+
 	var release struct {
 		TagName string `json:"tag_name"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
 		return "", err
 	}
+	if release.TagName == "" {
+		return "", fmt.Errorf("GitHub API returned no release of %s", repo)
+	}
 
 	return release.TagName, nil
 }
 
-// getCurrentYtDlpVersion gets the existing yt-dlp version tag
-func getCurrentYtDlpVersion() (string, error) {
-	cmd := exec.Command(utils.GetBinaryPath("yt-dlp"), "--version")
-	output, err := cmd.Output()
+// isYtDlpUpdateAvailable checks if the installed yt-dlp is not the version of the target:
+// the latest release of its channel, or the pinned version. checked is when the latest release was looked up,
+// it is older than this run when it comes from the cache.
+func isYtDlpUpdateAvailable() (isUpdateAvailable bool, current string, latest string, checked time.Time, err error) {
+	current, err = ProgramVersion("yt-dlp")
 	if err != nil {
-		return "", err
-	}
-	return strings.TrimSpace(string(output)), nil
-}
-
-// isYtDlpUpdateAvailable checks if a newer version of yt-dlp is available
-func isYtDlpUpdateAvailable() (isUpdateAvailable bool, current string, latest string, err error) {
-	current, err = getCurrentYtDlpVersion()
-	if err != nil {
-		return false, "", "", err
+		return false, "", "", time.Time{}, err
 	}
 
-	latest, err = getLatestYtDlpVersion()
-	if err != nil {
-		return false, "", "", err
+	if ytDlpTarget.IsPinned() {
+		latest, checked = ytDlpTarget.Version, time.Now()
+	} else if latest, checked, err = latestYtDlpVersion(ytDlpTarget.Channel); err != nil {
+		return false, "", "", time.Time{}, err
 	}
 	isUpdateAvailable = current != latest
 
-	return isUpdateAvailable, current, latest, nil
+	return isUpdateAvailable, current, latest, checked, nil
 }
@@ -0,0 +1,116 @@
+package dependencies
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// checksum files are small, a bigger response is not a checksum file
+const maxChecksumFileSize = 1024 * 1024
+
+var sha256Regex = regexp.MustCompile(`(?i)^[0-9a-f]{64}$`)
+
+// fetchChecksum downloads a checksum file and returns the SHA-256 digest of the file name in it.
+// It reads lists of "<digest>  <file name>" lines (yt-dlp's SHA2-256SUMS, BtbN's checksums.sha256)
+// and files holding the digest of a single file (deno's .sha256sum, which are PowerShell output on Windows).
+func fetchChecksum(checksumURL, fileName string) (string, error) {
+	req, _ := http.NewRequest("GET", checksumURL, nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+
+	resp, err := getHTTPClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot download the checksum of %s: %w", fileName, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("cannot download the checksum of %s: status %d", fileName, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxChecksumFileSize))
+	if err != nil {
+		return "", fmt.Errorf("cannot download the checksum of %s: %w", fileName, err)
+	}
+
+	digest, ok := findChecksum(string(data), fileName)
+	if !ok {
+		return "", fmt.Errorf("%s has no checksum for %s", checksumURL, fileName)
+	}
+	return digest, nil
+}
+
+// findChecksum returns the lowercase digest of the file name, or the only digest of the content
+func findChecksum(content, fileName string) (string, bool) {
+	var digests []string
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		for i, field := range fields {
+			if !sha256Regex.MatchString(field) {
+				continue
+			}
+			digest := strings.ToLower(field)
+			digests = append(digests, digest)
+
+			// "<digest>  <name>", or "<digest> *<name>" for binary mode
+			if i+1 < len(fields) && strings.TrimPrefix(fields[i+1], "*") == fileName {
+				return digest, true
+			}
+		}
+	}
+
+	if len(digests) == 1 {
+		return digests[0], true
+	}
+	return "", false
+}
+
+// fileSHA256 returns the lowercase hex SHA-256 digest of the file
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("cannot read %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// downloadVerified downloads the file to dest and checks its SHA-256 digest against the one of checksumURL.
+// The expected digest is fetched first, and dest is removed if the download doesn't match it.
+func downloadVerified(url, checksumURL, dest string) error {
+	fileName := filepath.Base(url)
+
+	expected, err := fetchChecksum(checksumURL, fileName)
+	if err != nil {
+		return err
+	}
+
+	if err := downloadFile(url, dest); err != nil {
+		os.Remove(dest)
+		return err
+	}
+
+	actual, err := fileSHA256(dest)
+	if err != nil {
+		os.Remove(dest)
+		return err
+	}
+
+	if actual != expected {
+		os.Remove(dest)
+		return fmt.Errorf("checksum mismatch for %s: expected SHA-256 %s, got %s. The download was rejected, it may be corrupted or tampered with",
+			fileName, expected, actual)
+	}
+	return nil
+}
@@ -1,10 +1,12 @@
 package dependencies
 
 import (
+	"downloader/internal/utils"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -19,9 +21,31 @@ var (
 	httpClientOnce sync.Once
 )
 
+// the proxy of the dependency downloads and update checks, "" uses the proxy environment variables
+var proxyURL string
+
+// SetProxy sets the proxy of the dependency downloads and update checks, before the first request.
+// "" uses the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables, utils.ProxyDirect connects directly.
+func SetProxy(proxy string) {
+	proxyURL = proxy
+}
+
+// proxyFor returns the proxy of the request, nil to connect directly. The hosts of NO_PROXY are always reached directly.
+func proxyFor(req *http.Request) (*url.URL, error) {
+	switch {
+	case proxyURL == "":
+		return http.ProxyFromEnvironment(req)
+	case proxyURL == utils.ProxyDirect || utils.BypassesProxy(req.URL.String(), utils.NoProxy()):
+		return nil, nil
+	default:
+		return url.Parse(proxyURL)
+	}
+}
+
 func getHTTPClient() *http.Client {
 	httpClientOnce.Do(func() {
 		transport := &http.Transport{
+			Proxy:               proxyFor,
 			MaxIdleConns:        100,
 			MaxIdleConnsPerHost: 100,
 			MaxConnsPerHost:     0, // Unlimited connections per host
@@ -191,58 +215,8 @@ func downloadChunk(url string, file *os.File, start, end int64) error {
 	return nil
 }
 
-// downloadYtDlp downloads the latest yt-dlp for the current OS
-func downloadYtDlp() error {
-
-	// download urls for different OSes
-	downloadUrls := map[string]string{
-		"windows": "https://github.com/yt-dlp/yt-dlp/releases/latest/download/yt-dlp.exe",
-		"linux":   "https://github.com/yt-dlp/yt-dlp/releases/latest/download/yt-dlp_linux",
-		"darwin":  "https://github.com/yt-dlp/yt-dlp/releases/latest/download/yt-dlp_macos",
-	}
-
-	// get current OS type
-	osType := runtime.GOOS
-
-	// get download url for current OS
-	downloadUrl, exist := downloadUrls[osType]
-	if !exist {
-		return fmt.Errorf("unsupported OS: %s", osType)
-	}
-
-	// determine filename for current OS
-	var fileName string
-	if osType == "windows" {
-		fileName = "yt-dlp.exe"
-	} else {
-		fileName = "yt-dlp"
-	}
-
-	// find directory of the running executable
-	execPath, err := os.Executable()
-	if err != nil {
-		return fmt.Errorf("cannot find executable path: %w", err)
-	}
-	execDir := filepath.Dir(execPath)
-
-	// create bin directory if it doesn't exist
-	binDir := filepath.Join(execDir, "bin")
-	if err := os.MkdirAll(binDir, 0755); err != nil {
-		return fmt.Errorf("cannot create bin directory: %w", err)
-	}
-
-	// download the file
-	destPath := filepath.Join(binDir, fileName)
-
-	if err := downloadFile(downloadUrl, destPath); err != nil {
-		return fmt.Errorf("cannot download yt-dlp: %w", err)
-	}
-
-	return nil
-}
-
 // downloadAndExtractFfmpeg downloads the latest FFmpeg for the current OS,
-// extracts the archive, places the ffmpeg binary into the bin folder,
+// verifies its checksum, extracts the archive, places the ffmpeg binary into the bin folder,
 // and removes the unneeded files.
 func downloadAndExtractFfmpeg() error {
 
@@ -254,6 +228,15 @@ func downloadAndExtractFfmpeg() error {
 		"darwin-arm64": "https://ffmpeg.martin-riedl.de/download/macos/arm64/1764095758_N-121850-g2b221fdb4a/ffmpeg.zip",
 	}
 
+	// the SHA-256 digests of the builds: BtbN lists all its builds in one file,
+	// martin-riedl.de publishes a .sha256 file next to each download
+	checksumUrls := map[string]string{
+		"windows":      "https://github.com/BtbN/FFmpeg-Builds/releases/latest/download/checksums.sha256",
+		"linux":        "https://github.com/BtbN/FFmpeg-Builds/releases/latest/download/checksums.sha256",
+		"darwin-amd64": downloadUrls["darwin-amd64"] + ".sha256",
+		"darwin-arm64": downloadUrls["darwin-arm64"] + ".sha256",
+	}
+
 	// get current OS type
 	osType := runtime.GOOS
 
@@ -284,8 +267,8 @@ func downloadAndExtractFfmpeg() error {
 	archiveName := filepath.Base(downloadUrl)
 	archivePath := filepath.Join(binDir, archiveName)
 
-	// download the archive
-	if err := downloadFile(downloadUrl, archivePath); err != nil {
+	// download the archive and verify it before anything is extracted
+	if err := downloadVerified(downloadUrl, checksumUrls[osType], archivePath); err != nil {
 		return fmt.Errorf("cannot download ffmpeg: %w", err)
 	}
 
@@ -356,7 +339,7 @@ func downloadAndExtractFfmpeg() error {
 }
 
 // DownloadAndExtractDeno downloads the latest Deno for the current OS,
-// extracts the archive, places the deno binary into the bin folder,
+// verifies its checksum, extracts the archive, places the deno binary into the bin folder,
 // and removes the unneeded files.
 func DownloadAndExtractDeno() error {
 
@@ -398,8 +381,8 @@ func DownloadAndExtractDeno() error {
 	archiveName := filepath.Base(downloadUrl)
 	archivePath := filepath.Join(binDir, archiveName)
 
-	// download the archive
-	if err := downloadFile(downloadUrl, archivePath); err != nil {
+	// download the archive and verify it with the .sha256sum file published next to it
+	if err := downloadVerified(downloadUrl, downloadUrl+".sha256sum", archivePath); err != nil {
 		return fmt.Errorf("cannot download deno: %w", err)
 	}
 
@@ -464,36 +447,3 @@ func DownloadAndExtractDeno() error {
 
 	return nil
 }
-
-// updateYtDlp removes the existing yt-dlp binary and downloads the latest version.
-func updateYtDlp() error {
-	// find directory of the running executable
-	execPath, err := os.Executable()
-	if err != nil {
-		return fmt.Errorf("cannot find executable path: %w", err)
-	}
-	execDir := filepath.Dir(execPath)
-
-	// path to existing yt-dlp binary
-	binDir := filepath.Join(execDir, "bin")
-	var ytDlpPath string
-	if runtime.GOOS == "windows" {
-		ytDlpPath = filepath.Join(binDir, "yt-dlp.exe")
-	} else {
-		ytDlpPath = filepath.Join(binDir, "yt-dlp")
-	}
-
-	// remove old binary if it exists
-	if _, err := os.Stat(ytDlpPath); err == nil {
-		if err := os.Remove(ytDlpPath); err != nil {
-			return fmt.Errorf("cannot remove old yt-dlp: %w", err)
-		}
-	}
-
-	// download the latest version
-	if err := downloadYtDlp(); err != nil {
-		return fmt.Errorf("cannot download latest yt-dlp: %w", err)
-	}
-
-	return nil
-}
@@ -0,0 +1,126 @@
+package dependencies
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// the lock file records the installed version of each program, in the bin directory
+const lockFileName = "deps.lock"
+
+// LockFile is the content of the lock file
+type LockFile struct {
+	Programs map[string]LockedProgram `json:"programs"`
+}
+
+// LockedProgram is an installed program in the lock file
+type LockedProgram struct {
+	Version string `json:"version"`
+	Channel string `json:"channel,omitempty"` // the release channel of yt-dlp
+	SHA256  string `json:"sha256"`            // the digest of the binary
+}
+
+// the channel of the yt-dlp installed or rolled back during this run, "" if yt-dlp wasn't changed
+var installedYtDlpChannel string
+
+// LockFilePath returns the path of the lock file
+func LockFilePath() (string, error) {
+	dir, err := binDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, lockFileName), nil
+}
+
+// ReadLockFile reads the lock file, a missing file is the same as an empty one
+func ReadLockFile() (*LockFile, error) {
+	lock := &LockFile{Programs: make(map[string]LockedProgram)}
+
+	path, err := LockFilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the lock file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("invalid lock file %s: %v", path, err)
+	}
+	if lock.Programs == nil {
+		lock.Programs = make(map[string]LockedProgram)
+	}
+	return lock, nil
+}
+
+// lockedYtDlpChannel returns the channel of the installed yt-dlp, stable if the lock file doesn't know it
+func lockedYtDlpChannel() string {
+	if lock, err := ReadLockFile(); err == nil && lock.Programs["yt-dlp"].Channel != "" {
+		return lock.Programs["yt-dlp"].Channel
+	}
+	return ChannelStable
+}
+
+// updateLockFile records the versions of the installed programs. The digest of a binary is only computed again
+// when its version changed, and the file is only written when something changed.
+func updateLockFile() error {
+	lock, err := ReadLockFile()
+	if err != nil {
+		return err
+	}
+
+	updated := &LockFile{Programs: make(map[string]LockedProgram)}
+	for _, program := range Programs {
+		version, err := ProgramVersion(program)
+		if err != nil {
+			continue
+		}
+
+		locked := lock.Programs[program]
+		entry := LockedProgram{Version: version, SHA256: locked.SHA256}
+
+		if program == "yt-dlp" {
+			entry.Channel = locked.Channel
+			if installedYtDlpChannel != "" {
+				entry.Channel = installedYtDlpChannel
+			}
+			if entry.Channel == "" {
+				entry.Channel = ChannelStable
+			}
+		}
+
+		if locked.Version != version || locked.SHA256 == "" || program == "yt-dlp" && installedYtDlpChannel != "" {
+			if entry.SHA256, err = fileSHA256(BinaryPath(program)); err != nil {
+				continue
+			}
+		}
+
+		updated.Programs[program] = entry
+	}
+
+	if reflect.DeepEqual(lock, updated) {
+		return nil
+	}
+
+	path, err := LockFilePath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(updated, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot write the lock file: %w", err)
+	}
+	return nil
+}
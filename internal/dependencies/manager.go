@@ -2,8 +2,10 @@ package dependencies
 
 import (
 	"downloader/internal/ui"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 )
 
 // EnsureReady checks for required external dependencies (yt-dlp, ffmpeg, deno),
@@ -11,30 +13,53 @@ import (
 // and ensure yt-dlp is up-to-date
 func EnsureReady() error {
 	// Print header
-	fmt.Println("Verifying dependencies...")
-	fmt.Println()
+	ui.Println("Verifying dependencies...")
+	ui.Println()
 
-	programs := []string{"yt-dlp", "ffmpeg", "deno"}
 	progressLines := make(map[string]*ui.ProgressLine)
 	ytdlpExists := false
+	var ytdlp Binary
+
+	// the programs that can't be used: their path in the settings doesn't work (they are not installed
+	// in the bin directory instead), or they are missing and couldn't be downloaded
+	var mu sync.Mutex
+	var failures []error
+	addFailure := func(err error) {
+		mu.Lock()
+		failures = append(failures, err)
+		mu.Unlock()
+	}
 
 	var wg sync.WaitGroup
 
 	// Phase 1: Check all programs in parallel
-	for _, program := range programs {
+	for _, program := range Programs {
 		wg.Add(1)
 		progressLines[program] = ui.ShowLoading("Checking for " + program)
 
 		go func() {
 			defer wg.Done()
 
-			if programExists(program) {
-				progressLines[program].Complete(program + " found")
+			binary, err := ResolveBinary(program)
+			switch {
+			case err == nil:
+				found := program + " found"
+				if binary.Source != SourceBinDir {
+					found += " at " + binary.Path
+				}
+				progressLines[program].Complete(found)
 				if program == "yt-dlp" {
 					ytdlpExists = true
+					ytdlp = binary
 				}
-			} else {
-				progressLines[program].Fail(program + " not found")
+			case !errors.Is(err, errBinaryNotFound):
+				progressLines[program].Fail(err.Error())
+				addFailure(err)
+			case offline:
+				progressLines[program].Fail(program + " not found, it can't be downloaded offline")
+				addFailure(fmt.Errorf("%w, and it can't be downloaded offline", err))
+			default:
+				progressLines[program].Warn(program + " not found")
 
 				// Download missing program
 				downloadProgressLine := ui.ShowLoading("Downloading " + program)
@@ -49,8 +74,10 @@ func EnsureReady() error {
 					err = DownloadAndExtractDeno()
 				}
 
+				forgetBinary(program)
 				if err != nil {
 					downloadProgressLine.Fail("Failed to download " + program)
+					addFailure(fmt.Errorf("cannot download %s: %w", program, err))
 				} else {
 					downloadProgressLine.Complete("Downloaded " + program)
 				}
@@ -64,33 +91,70 @@ func EnsureReady() error {
 	ui.StopMultiPrinter()
 
 	// Add blank line between phases
-	fmt.Println()
+	ui.Println()
+
+	if len(failures) > 0 {
+		return errors.Join(failures...)
+	}
+
+	// Phase 2: Check for yt-dlp updates (only if it already existed). A yt-dlp from the settings or PATH
+	// is updated by whoever installed it, only a pinned version is installed in the bin directory.
+	// yt-dlp is installed, so the update failures are only warnings and the installed version is used.
+	switch {
+	case !ytdlpExists:
+
+	case ytdlp.Source != SourceBinDir && (ytdlp.Source == SourceConfig || !ytDlpTarget.IsPinned()):
+		ui.Printf("Using yt-dlp %s from %s, it isn't updated by the app\n", ytdlp.Version, ytdlp.Path)
 
-	// Phase 2: Check for yt-dlp updates (only if it already existed)
-	if ytdlpExists {
+	case offline && ytDlpTarget.IsPinned() && ytdlp.Version != ytDlpTarget.Version:
+		ui.Warnln(fmt.Sprintf("yt-dlp is pinned to %s, but %s is installed and can't be switched offline", ytDlpTarget.Version, ytdlp.Version))
+
+	case offline:
+		ui.Printf("Offline: using yt-dlp %s without checking for updates\n", ytdlp.Version)
+
+	default:
 		updateLine := ui.ShowLoading("Checking for yt-dlp updates")
 
-		hasUpdate, currentVersion, latestVersion, err := isYtDlpUpdateAvailable()
+		hasUpdate, currentVersion, latestVersion, checked, err := isYtDlpUpdateAvailable()
 		if err != nil {
-			updateLine.Fail("Failed to check for yt-dlp updates: " + err.Error())
-			ui.StopMultiPrinter()
-			return err
+			updateLine.Warn("Could not check for yt-dlp updates, using " + ytdlp.Version + ": " + err.Error())
+			break
 		}
 
-		if hasUpdate {
-			updateLine.Fail("Update available")
+		switch {
+		case hasUpdate && ytDlpTarget.IsPinned():
+			updateLine.Warn("yt-dlp is pinned to " + latestVersion)
+
+			// Switch to the pinned version, the installed one is kept for rollbacks
+			downloadLine := ui.ShowLoading("Switching yt-dlp from " + currentVersion + " to " + latestVersion)
+
+			if err := installYtDlp(ytDlpTarget.Channel, latestVersion); err != nil {
+				downloadLine.Warn("Failed to switch yt-dlp, using " + currentVersion + ": " + err.Error())
+				break
+			}
 
-			// Download the update
+			downloadLine.Complete("Switched yt-dlp to " + latestVersion)
+
+		case hasUpdate:
+			updateLine.Warn("Update available")
+
+			// Download the update, the installed version is kept for rollbacks
 			downloadLine := ui.ShowLoading("Updating yt-dlp from " + currentVersion + " to " + latestVersion)
 
-			if err := updateYtDlp(); err != nil {
-				downloadLine.Fail("Failed to update yt-dlp: " + err.Error())
-				ui.StopMultiPrinter()
-				return err
+			if err := installYtDlp(ytDlpTarget.Channel, latestVersion); err != nil {
+				downloadLine.Warn("Failed to update yt-dlp, using " + currentVersion + ": " + err.Error())
+				break
 			}
 
 			downloadLine.Complete("Updated yt-dlp to " + latestVersion)
-		} else {
+
+		case ytDlpTarget.IsPinned():
+			updateLine.Complete("yt-dlp is pinned to " + currentVersion)
+
+		case time.Since(checked) >= time.Minute:
+			updateLine.Complete(fmt.Sprintf("yt-dlp is up to date (%s, checked %s ago)", currentVersion, formatAge(time.Since(checked))))
+
+		default:
 			updateLine.Complete("yt-dlp is up to date (" + currentVersion + ")")
 		}
 	}
@@ -98,11 +162,24 @@ func EnsureReady() error {
 	// Stop the multi-printer at the end
 	ui.StopMultiPrinter()
 
+	// Record the installed versions
+	if err := updateLockFile(); err != nil {
+		ui.Warnln("Could not update the lock file:", err)
+	}
+
 	// Print footer
-	fmt.Println()
-	fmt.Println("Dependencies ready!")
-	fmt.Println("----------------------------------------")
-	fmt.Println()
+	ui.Println()
+	ui.Println("Dependencies ready!")
+	ui.Println("----------------------------------------")
+	ui.Println()
 
 	return nil
 }
+
+// formatAge formats the time since the last update check, e.g. "5h" or "12m"
+func formatAge(d time.Duration) string {
+	if d >= time.Hour {
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dm", int(d.Minutes()))
+}
@@ -0,0 +1,174 @@
+package dependencies
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// where a program was found
+const (
+	SourceConfig = "config" // the path set in the settings (ytdlp_path, ffmpeg_path, deno_path)
+	SourceBinDir = "bin"    // the bin directory next to the executable, where the app installs the programs
+	SourcePath   = "PATH"   // the PATH environment variable
+)
+
+// Binary is a program found by ResolveBinary
+type Binary struct {
+	Program string
+	Path    string
+	Source  string
+	Version string
+}
+
+var (
+	binaryPaths = map[string]string{} // the paths set in the settings, by program
+	resolved    = map[string]Binary{} // the programs already found, by program
+	resolveMu   sync.Mutex
+)
+
+// errBinaryNotFound is returned by ResolveBinary when a program without a path in the settings isn't found
+var errBinaryNotFound = errors.New("not found")
+
+// SetBinaryPaths sets the paths of the programs given in the settings, by program. A program with a path
+// is only looked for there, the others are looked for in the bin directory and then in PATH.
+func SetBinaryPaths(paths map[string]string) {
+	resolveMu.Lock()
+	defer resolveMu.Unlock()
+
+	binaryPaths = make(map[string]string)
+	for program, path := range paths {
+		if path != "" {
+			binaryPaths[program] = path
+		}
+	}
+	clear(resolved)
+}
+
+// forgetBinary makes the next ResolveBinary look for the program again, after it was installed or replaced
+func forgetBinary(program string) {
+	resolveMu.Lock()
+	defer resolveMu.Unlock()
+	delete(resolved, program)
+}
+
+// binaryFileName returns the file name of the program for the current OS
+func binaryFileName(program string) string {
+	if runtime.GOOS == "windows" {
+		return program + ".exe"
+	}
+	return program
+}
+
+// installPath returns the path the app installs the program to, in the bin directory
+func installPath(program string) string {
+	dir, err := binDir()
+	if err != nil {
+		return binaryFileName(program)
+	}
+	return filepath.Join(dir, binaryFileName(program))
+}
+
+// ResolveBinary finds a program that runs: at the path of the settings, or else in the bin directory
+// next to the executable and then in PATH. Each candidate is confirmed by running it with --version.
+func ResolveBinary(program string) (Binary, error) {
+	resolveMu.Lock()
+	binary, found := resolved[program]
+	explicitPath, explicit := binaryPaths[program]
+	resolveMu.Unlock()
+
+	if found {
+		return binary, nil
+	}
+
+	if explicit {
+		version, err := versionAt(explicitPath, program)
+		if err != nil {
+			return Binary{}, fmt.Errorf("the %s path %s doesn't work: %v", program, explicitPath, err)
+		}
+		binary = Binary{Program: program, Path: explicitPath, Source: SourceConfig, Version: version}
+	} else {
+		binary, found = findBinary(program)
+		if !found {
+			return Binary{}, fmt.Errorf("%s %w (looked in %s and PATH)", program, errBinaryNotFound, filepath.Dir(installPath(program)))
+		}
+	}
+
+	resolveMu.Lock()
+	resolved[program] = binary
+	resolveMu.Unlock()
+	return binary, nil
+}
+
+// findBinary looks for a working program in the bin directory, then in PATH
+func findBinary(program string) (Binary, bool) {
+	binPath := installPath(program)
+	if version, err := versionAt(binPath, program); err == nil {
+		return Binary{Program: program, Path: binPath, Source: SourceBinDir, Version: version}, true
+	}
+
+	path, err := exec.LookPath(program)
+	if err != nil {
+		return Binary{}, false
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if version, err := versionAt(path, program); err == nil {
+		return Binary{Program: program, Path: path, Source: SourcePath, Version: version}, true
+	}
+	return Binary{}, false
+}
+
+// BinaryPath returns the path of the program to run, or the path it is installed to if it wasn't found
+func BinaryPath(program string) string {
+	if binary, err := ResolveBinary(program); err == nil {
+		return binary.Path
+	}
+
+	resolveMu.Lock()
+	defer resolveMu.Unlock()
+	if path, ok := binaryPaths[program]; ok {
+		return path
+	}
+	return installPath(program)
+}
+
+// versionAt runs the program with its version flag and returns the version it reports,
+// e.g. "2025.01.01" for yt-dlp, "7.1" for ffmpeg and "2.1.4" for deno
+func versionAt(path, program string) (string, error) {
+	if info, err := os.Stat(path); err != nil {
+		return "", err
+	} else if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+
+	versionFlag := "--version"
+	if program == "ffmpeg" {
+		versionFlag = "-version"
+	}
+
+	output, err := exec.Command(path, versionFlag).Output()
+	if err != nil {
+		return "", err
+	}
+
+	// "ffmpeg version 7.1 Copyright...", "deno 2.1.4 (stable, release...)" or "2025.01.01"
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	fields := strings.Fields(firstLine)
+	switch {
+	case len(fields) == 0:
+		return "", fmt.Errorf("%s %s printed nothing", path, versionFlag)
+	case program == "ffmpeg" && len(fields) > 2:
+		return fields[2], nil
+	case program == "deno" && len(fields) > 1:
+		return fields[1], nil
+	default:
+		return strings.TrimSpace(firstLine), nil
+	}
+}
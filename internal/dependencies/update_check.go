@@ -0,0 +1,128 @@
+package dependencies
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultUpdateInterval is how often the latest yt-dlp release is looked up by default
+const defaultUpdateInterval = 24 * time.Hour
+
+var (
+	// how long the latest release of a channel is remembered, 0 looks it up on every run
+	updateInterval = defaultUpdateInterval
+
+	// true skips every network access: nothing is downloaded and the updates are not checked
+	offline bool
+)
+
+// SetUpdateInterval sets how long the latest yt-dlp release is remembered before it is looked up again
+func SetUpdateInterval(interval time.Duration) {
+	updateInterval = interval
+}
+
+// SetOffline makes EnsureReady use the installed programs without any network access
+func SetOffline(value bool) {
+	offline = value
+}
+
+// ParseUpdateInterval parses an update interval: a Go duration such as "12h" or "30m", a number of days such as "7d",
+// or "0" to check on every run
+func ParseUpdateInterval(s string) (time.Duration, error) {
+	var interval time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid update interval %q (expected e.g. 24h, 7d or 0)", s)
+		}
+		interval = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if interval, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid update interval %q (expected e.g. 24h, 7d or 0)", s)
+		}
+	}
+
+	if interval < 0 {
+		return 0, fmt.Errorf("invalid update interval %q: it can't be negative", s)
+	}
+	return interval, nil
+}
+
+// updateCheck is the cache of the latest yt-dlp releases, by channel
+type updateCheck struct {
+	Channels map[string]checkedRelease `json:"channels"`
+}
+
+// checkedRelease is the latest release of a channel when it was looked up
+type checkedRelease struct {
+	Version string    `json:"version"`
+	Checked time.Time `json:"checked"`
+}
+
+// updateCheckPath returns the path of the update check cache in the user cache folder, "" if there is none
+func updateCheckPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "downloader", "update-check.json")
+}
+
+// loadUpdateCheck reads the update check cache, a missing or invalid file is the same as an empty one
+func loadUpdateCheck(path string) *updateCheck {
+	check := &updateCheck{Channels: make(map[string]checkedRelease)}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, check)
+	}
+	if check.Channels == nil {
+		check.Channels = make(map[string]checkedRelease)
+	}
+	return check
+}
+
+func (c *updateCheck) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// latestYtDlpVersion returns the latest release of the channel and when it was looked up. The release is taken
+// from the cache while it is younger than the update interval, so GitHub is asked at most once per interval.
+func latestYtDlpVersion(channel string) (string, time.Time, error) {
+	path := updateCheckPath()
+	var check *updateCheck
+	if path != "" {
+		check = loadUpdateCheck(path)
+		if cached, ok := check.Channels[channel]; ok && cached.Version != "" && time.Since(cached.Checked) < updateInterval {
+			return cached.Version, cached.Checked, nil
+		}
+	}
+
+	if offline {
+		return "", time.Time{}, fmt.Errorf("cannot look up the latest yt-dlp %s release offline", channel)
+	}
+
+	version, err := getLatestYtDlpVersion(channelRepos[channel])
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	if check != nil {
+		// the cache only saves requests, a run without it still works
+		check.Channels[channel] = checkedRelease{Version: version, Checked: now}
+		check.save(path)
+	}
+	return version, now, nil
+}
@@ -0,0 +1,344 @@
+package dependencies
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// yt-dlp release channels, each one is published by its own GitHub repository
+const (
+	ChannelStable  = "stable"
+	ChannelNightly = "nightly"
+	ChannelMaster  = "master"
+)
+
+var channelRepos = map[string]string{
+	ChannelStable:  "yt-dlp/yt-dlp",
+	ChannelNightly: "yt-dlp/yt-dlp-nightly-builds",
+	ChannelMaster:  "yt-dlp/yt-dlp-master-builds",
+}
+
+// the folder of the bin directory holding the replaced yt-dlp binaries, for rollbacks
+const versionsDirName = "versions"
+
+// how many replaced yt-dlp binaries are kept, the oldest ones are removed
+const keptYtDlpVersions = 5
+
+// yt-dlp versions are release dates, nightly and master builds add the build time (e.g. "2025.01.16.232854")
+var ytDlpVersionRegex = regexp.MustCompile(`^\d{4}\.\d{2}\.\d{2}(\.\d+)?$`)
+
+// YtDlpTarget is the yt-dlp version EnsureReady installs: the latest release of a channel, or a pinned version
+type YtDlpTarget struct {
+	Channel string
+	Version string // the pinned version, "" follows the latest release of the channel
+}
+
+// ParseYtDlpTarget parses a yt-dlp version written like yt-dlp --update-to: a channel ("stable", "nightly" or "master"),
+// a version of the stable channel (e.g. "2025.01.15") or "<channel>@<version>" (e.g. "nightly@2025.01.16.232854")
+func ParseYtDlpTarget(s string) (YtDlpTarget, error) {
+	channel, version, hasChannel := strings.Cut(s, "@")
+	if !hasChannel {
+		if _, ok := channelRepos[s]; ok {
+			return YtDlpTarget{Channel: s}, nil
+		}
+		channel, version = ChannelStable, s
+	}
+
+	if _, ok := channelRepos[channel]; !ok {
+		return YtDlpTarget{}, fmt.Errorf("unknown yt-dlp channel %q (expected stable, nightly or master)", channel)
+	}
+	if !ytDlpVersionRegex.MatchString(version) {
+		return YtDlpTarget{}, fmt.Errorf("invalid yt-dlp version %q (expected stable, nightly, master or a version such as 2025.01.15)", version)
+	}
+	return YtDlpTarget{Channel: channel, Version: version}, nil
+}
+
+// IsPinned returns true if the target is an exact version
+func (t YtDlpTarget) IsPinned() bool {
+	return t.Version != ""
+}
+
+// String returns the target as it is written in the setting
+func (t YtDlpTarget) String() string {
+	switch {
+	case !t.IsPinned():
+		return t.Channel
+	case t.Channel == ChannelStable:
+		return t.Version
+	default:
+		return t.Channel + "@" + t.Version
+	}
+}
+
+// the yt-dlp version EnsureReady installs
+var ytDlpTarget = YtDlpTarget{Channel: ChannelStable}
+
+// SetYtDlpTarget sets the yt-dlp version EnsureReady installs, the latest stable release by default
+func SetYtDlpTarget(target YtDlpTarget) {
+	ytDlpTarget = target
+}
+
+// resolveYtDlpVersion returns the version of the target: the pinned one, or the latest release of the channel
+// (see latestYtDlpVersion)
+func resolveYtDlpVersion(target YtDlpTarget) (string, error) {
+	if target.IsPinned() {
+		return target.Version, nil
+	}
+	version, _, err := latestYtDlpVersion(target.Channel)
+	return version, err
+}
+
+// binDir returns the bin directory next to the executable, where the programs are installed
+func binDir() (string, error) {
+	execPath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("cannot find executable path: %w", err)
+	}
+	return filepath.Join(filepath.Dir(execPath), "bin"), nil
+}
+
+// downloadYtDlp installs the yt-dlp version of the target for the current OS
+func downloadYtDlp() error {
+	version, err := resolveYtDlpVersion(ytDlpTarget)
+	if err != nil {
+		return fmt.Errorf("cannot find the latest yt-dlp %s release: %w", ytDlpTarget.Channel, err)
+	}
+	return installYtDlp(ytDlpTarget.Channel, version)
+}
+
+// installYtDlp downloads a yt-dlp release, verifies its checksum and replaces the installed binary,
+// which is kept in bin/versions
+func installYtDlp(channel, version string) error {
+
+	// the release files for different OSes
+	assetNames := map[string]string{
+		"windows": "yt-dlp.exe",
+		"linux":   "yt-dlp_linux",
+		"darwin":  "yt-dlp_macos",
+	}
+
+	assetName, exist := assetNames[runtime.GOOS]
+	if !exist {
+		return fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	}
+
+	dir, err := binDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot create bin directory: %w", err)
+	}
+
+	// every release publishes the SHA-256 digests of its files in SHA2-256SUMS
+	releaseUrl := fmt.Sprintf("https://github.com/%s/releases/download/%s/", channelRepos[channel], version)
+
+	// download the file next to the binary and check it before replacing the binary,
+	// so a failed or rejected download keeps the installed version
+	destPath := filepath.Join(dir, binaryFileName("yt-dlp"))
+	tmpPath := destPath + ".download"
+
+	if err := downloadVerified(releaseUrl+assetName, releaseUrl+"SHA2-256SUMS", tmpPath); err != nil {
+		return fmt.Errorf("cannot download yt-dlp %s: %w", version, err)
+	}
+
+	// make executable on Linux/macOS
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(tmpPath, 0755); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("cannot set executable permissions: %w", err)
+		}
+	}
+
+	keptPath, err := keepYtDlpBinary(destPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		os.Remove(tmpPath)
+		if keptPath != "" {
+			os.Rename(keptPath, destPath)
+		}
+		return fmt.Errorf("cannot install yt-dlp: %w", err)
+	}
+
+	installedYtDlpChannel = channel
+	forgetBinary("yt-dlp")
+	return nil
+}
+
+// ytDlpVersionAt returns the version of the yt-dlp binary, "" if it doesn't run
+func ytDlpVersionAt(path string) string {
+	version, _ := versionAt(path, "yt-dlp")
+	return version
+}
+
+// KeptYtDlp is a replaced yt-dlp binary kept in bin/versions: yt-dlp-<channel>-<version>
+type KeptYtDlp struct {
+	Channel string
+	Version string
+	Path    string
+}
+
+// Target returns the target that pins the kept version
+func (k KeptYtDlp) Target() YtDlpTarget {
+	return YtDlpTarget{Channel: k.Channel, Version: k.Version}
+}
+
+// keptYtDlpPath returns the path of a kept binary in the versions folder
+func keptYtDlpPath(dir, channel, version string) string {
+	name := fmt.Sprintf("yt-dlp-%s-%s", channel, version)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(dir, versionsDirName, name)
+}
+
+// keepYtDlpBinary moves the installed binary to the versions folder, with the version it reports and the channel
+// of the lock file, and removes the oldest kept binaries. It returns the path the binary was moved to, "" if there is
+// none: a binary that doesn't run can't be rolled back to and is replaced.
+func keepYtDlpBinary(path string) (string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", nil
+	}
+
+	version := ytDlpVersionAt(path)
+	if version == "" {
+		return "", nil
+	}
+
+	channel := lockedYtDlpChannel()
+	dir := filepath.Dir(path)
+	keptPath := keptYtDlpPath(dir, channel, version)
+
+	if err := os.MkdirAll(filepath.Dir(keptPath), 0755); err != nil {
+		return "", fmt.Errorf("cannot create the versions directory: %w", err)
+	}
+	if err := os.Rename(path, keptPath); err != nil {
+		return "", fmt.Errorf("cannot keep yt-dlp %s: %w", version, err)
+	}
+
+	kept, err := KeptYtDlpVersions()
+	if err != nil {
+		return keptPath, nil
+	}
+	for _, k := range kept[min(len(kept), keptYtDlpVersions):] {
+		os.Remove(k.Path)
+	}
+	return keptPath, nil
+}
+
+// KeptYtDlpVersions returns the yt-dlp binaries kept in bin/versions, the most recent version first
+func KeptYtDlpVersions() ([]KeptYtDlp, error) {
+	dir, err := binDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, versionsDirName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the versions directory: %w", err)
+	}
+
+	var kept []KeptYtDlp
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".exe")
+		channel, version, ok := strings.Cut(strings.TrimPrefix(name, "yt-dlp-"), "-")
+		if entry.IsDir() || !strings.HasPrefix(name, "yt-dlp-") || !ok {
+			continue
+		}
+		if _, known := channelRepos[channel]; !known || !ytDlpVersionRegex.MatchString(version) {
+			continue
+		}
+		kept = append(kept, KeptYtDlp{
+			Channel: channel,
+			Version: version,
+			Path:    filepath.Join(dir, versionsDirName, entry.Name()),
+		})
+	}
+
+	// the versions are dates, so they sort by age
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].Version > kept[j].Version
+	})
+	return kept, nil
+}
+
+// RollbackYtDlp switches yt-dlp to a kept binary: the version (written like a pinned target, e.g. "2025.01.15"
+// or "nightly@2025.01.16.232854"), or the most recent kept one if version is "". The installed binary is kept
+// in its place, so a rollback can be undone the same way. The lock file is updated.
+func RollbackYtDlp(version string) (KeptYtDlp, error) {
+	kept, err := KeptYtDlpVersions()
+	if err != nil {
+		return KeptYtDlp{}, err
+	}
+	if len(kept) == 0 {
+		return KeptYtDlp{}, fmt.Errorf("there is no previous yt-dlp version to roll back to, they are kept in bin/%s when yt-dlp is updated", versionsDirName)
+	}
+
+	chosen := kept[0]
+	if version != "" {
+		found := false
+		for _, k := range kept {
+			if k.Version == version || k.Target().String() == version {
+				chosen, found = k, true
+				break
+			}
+		}
+		if !found {
+			available := make([]string, len(kept))
+			for i, k := range kept {
+				available[i] = k.Target().String()
+			}
+			return KeptYtDlp{}, fmt.Errorf("yt-dlp %s is not kept in bin/%s (available: %s)", version, versionsDirName, strings.Join(available, ", "))
+		}
+	}
+
+	dir, err := binDir()
+	if err != nil {
+		return KeptYtDlp{}, err
+	}
+	destPath := filepath.Join(dir, binaryFileName("yt-dlp"))
+
+	if ytDlpVersionAt(destPath) == chosen.Version {
+		return KeptYtDlp{}, fmt.Errorf("yt-dlp %s is already installed", chosen.Version)
+	}
+
+	// the chosen binary leaves the versions folder first, so keeping the installed one can't remove it
+	// (e.g. when rolling back to the oldest of a full folder)
+	restorePath := destPath + ".rollback"
+	if err := os.Rename(chosen.Path, restorePath); err != nil {
+		return KeptYtDlp{}, fmt.Errorf("cannot restore yt-dlp %s: %w", chosen.Version, err)
+	}
+
+	keptPath, err := keepYtDlpBinary(destPath)
+	if err != nil {
+		os.Rename(restorePath, chosen.Path)
+		return KeptYtDlp{}, err
+	}
+	if err := os.Rename(restorePath, destPath); err != nil {
+		// put both binaries back where they were
+		if keptPath != "" {
+			os.Rename(keptPath, destPath)
+		}
+		os.Rename(restorePath, chosen.Path)
+		return KeptYtDlp{}, fmt.Errorf("cannot restore yt-dlp %s: %w", chosen.Version, err)
+	}
+
+	installedYtDlpChannel = chosen.Channel
+	forgetBinary("yt-dlp")
+	if err := updateLockFile(); err != nil {
+		return chosen, err
+	}
+	return chosen, nil
+}
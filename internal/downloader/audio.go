@@ -0,0 +1,47 @@
+package downloader
+
+import (
+	"downloader/internal/models"
+	"strings"
+)
+
+// audioArgs returns the yt-dlp arguments for an audio-only download.
+// When a format is chosen, the audio is converted by yt-dlp's extract-audio post-processor.
+func audioArgs(output models.AudioOutput) []string {
+
+	// 0 is the best VBR quality, it is also used when the audio is kept as is
+	quality := "0"
+	if output.Quality != "" && !output.IsLossless() {
+		quality = output.Quality
+	}
+
+	args := []string{"--audio-quality", quality}
+
+	if output.Format != "" {
+		args = append(args, "--extract-audio", "--audio-format", output.Format)
+	}
+
+	return args
+}
+
+// audioFileSuffix returns the file name suffix of an audio download, showing the chosen format.
+// e.g. "audio" (original format), "audio-mp3-192k", "audio-opus-q5" or "audio-flac"
+func audioFileSuffix(output models.AudioOutput) string {
+	suffix := "audio"
+
+	if output.Format == "" {
+		return suffix
+	}
+
+	suffix += "-" + output.Format
+
+	if output.Quality != "" && !output.IsLossless() {
+		if strings.HasSuffix(output.Quality, "K") {
+			suffix += "-" + strings.ToLower(output.Quality)
+		} else {
+			suffix += "-q" + output.Quality
+		}
+	}
+
+	return suffix
+}
@@ -0,0 +1,202 @@
+package downloader
+
+import (
+	"downloader/internal/config"
+	"downloader/internal/sites"
+	"downloader/internal/ui"
+	"downloader/internal/utils"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// authArgs returns the yt-dlp arguments for the cookies and the .netrc logins.
+// The cookies of the site profile replace the global ones.
+func authArgs(cfg *config.Config, site sites.Profile) []string {
+	var args []string
+
+	cookies, browser := cfg.Cookies, cfg.CookiesFromBrowser
+	if site.Cookies != "" || site.CookiesFromBrowser != "" {
+		cookies, browser = site.Cookies, site.CookiesFromBrowser
+	}
+
+	switch {
+	case cookies != "":
+		args = append(args, "--cookies", cookies)
+	case browser != "":
+		args = append(args, "--cookies-from-browser", browser)
+	}
+
+	if cfg.Netrc != "" {
+		args = append(args, "--netrc", "--netrc-location", cfg.Netrc)
+	}
+
+	return args
+}
+
+// cookieCopy is the private copy of the cookie file used by one download attempt
+type cookieCopy struct {
+	original string // the cookie file of the settings, "" if the command has none
+	path     string
+}
+
+// the locks of the cookie files, by path. yt-dlp refreshes the cookies during a download,
+// the copies are read and written back under the lock of their file.
+var (
+	cookieLocksMu sync.Mutex
+	cookieLocks   = map[string]*sync.Mutex{}
+)
+
+func lockCookieFile(path string) func() {
+	cookieLocksMu.Lock()
+	lock, ok := cookieLocks[path]
+	if !ok {
+		lock = &sync.Mutex{}
+		cookieLocks[path] = lock
+	}
+	cookieLocksMu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// isolateCookieFile replaces the cookie file of the command with a private copy.
+// yt-dlp writes the cookies back to the file when it exits, so parallel downloads sharing the file
+// could read it while another one rewrites it.
+func isolateCookieFile(cmd *exec.Cmd) (*cookieCopy, error) {
+	i := slices.Index(cmd.Args, "--cookies")
+	if i < 0 || i+1 >= len(cmd.Args) {
+		return &cookieCopy{}, nil
+	}
+
+	original := cmd.Args[i+1]
+	defer lockCookieFile(original)()
+
+	src, err := os.Open(original)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the cookie file: %v", err)
+	}
+	defer src.Close()
+
+	// CreateTemp creates the file readable only by the user
+	dst, err := os.CreateTemp("", "downloader-cookies-*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("cannot copy the cookie file: %v", err)
+	}
+
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return nil, fmt.Errorf("cannot copy the cookie file: %v", err)
+	}
+
+	cmd.Args[i+1] = dst.Name()
+	return &cookieCopy{original: original, path: dst.Name()}, nil
+}
+
+// finish removes the copy. After a successful attempt, the cookies yt-dlp refreshed are saved to the cookie file
+// first, so expiring session cookies keep working. When parallel downloads refresh them, the last one is kept.
+func (c *cookieCopy) finish(succeeded bool) {
+	if c.path == "" {
+		return
+	}
+	defer os.Remove(c.path)
+
+	if succeeded {
+		if err := c.saveBack(); err != nil {
+			ui.Warnln(fmt.Sprintf("Could not save the refreshed cookies to %s: %v", c.original, err))
+		}
+	}
+}
+
+// saveBack replaces the cookie file with the copy, through a temporary file in its folder so it is never half written
+func (c *cookieCopy) saveBack() error {
+	data, err := os.ReadFile(c.path)
+	if err != nil || len(data) == 0 {
+		// yt-dlp didn't save the cookies, the file is kept as it is
+		return err
+	}
+
+	defer lockCookieFile(c.original)()
+
+	info, err := os.Stat(c.original)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.original), ".cookies-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), info.Mode().Perm())
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.original)
+}
+
+// what secrets are replaced with in logs and dry runs
+const maskedSecret = "****"
+
+// the yt-dlp options whose value is a secret
+var secretOptions = []string{"-p", "--password", "--video-password", "--ap-password", "-2", "--twofactor", "--client-certificate-password"}
+
+// isSecretHeader returns true if the HTTP header holds credentials
+func isSecretHeader(name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "authorization", "proxy-authorization", "cookie", "set-cookie":
+		return true
+	}
+	return strings.Contains(name, "token") || strings.Contains(name, "secret") || strings.Contains(name, "api-key")
+}
+
+// maskSecrets returns a copy of the command arguments with the passwords, the credential headers
+// and the passwords of URLs (e.g. of a proxy) hidden, for the logs and dry runs
+func maskSecrets(args []string) []string {
+	masked := make([]string, len(args))
+	for i, arg := range args {
+		switch {
+		case i > 0 && slices.Contains(secretOptions, args[i-1]):
+			arg = maskedSecret
+		case i > 0 && args[i-1] == "--add-header":
+			if name, _, ok := strings.Cut(arg, ":"); ok && isSecretHeader(name) {
+				arg = name + ":" + maskedSecret
+			}
+		default:
+			if name, _, ok := strings.Cut(arg, "="); ok && slices.Contains(secretOptions, name) {
+				arg = name + "=" + maskedSecret
+			}
+			arg = utils.MaskURLPassword(arg)
+		}
+		masked[i] = arg
+	}
+	return masked
+}
+
+// matches the credential headers printed by yt-dlp --print-traffic, e.g. "header: Cookie: SID=abc"
+var secretHeaderLineRegex = regexp.MustCompile(`(?i)\b(cookie|set-cookie|authorization|proxy-authorization):\s*\S.*$`)
+
+// maskSecretLine hides the credential headers and the passwords of URLs (e.g. of the proxy in the
+// "[debug] Command-line config" and "Proxy map" lines of -v) in a line of the yt-dlp output
+func maskSecretLine(line string) string {
+	line = secretHeaderLineRegex.ReplaceAllString(line, "$1: "+maskedSecret)
+	return utils.MaskURLPasswords(line)
+}
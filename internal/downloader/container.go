@@ -0,0 +1,142 @@
+package downloader
+
+import (
+	"downloader/internal/config"
+	"downloader/internal/models"
+	"slices"
+	"strings"
+)
+
+// containerSpec describes how to get a video in a container
+type containerSpec struct {
+	// the extensions of the site streams that fit the container without conversion, "" if none
+	videoExt string
+	audioExt string
+
+	// the start of the yt-dlp acodec values of the audio streams the container holds, "" if it holds all of them
+	audioCodec string
+
+	// the video codecs the container can hold, nil if it holds all of them
+	codecs []string
+
+	// true if any stream can be remuxed into the container without re-encoding
+	remuxesAll bool
+
+	// true if the container can hold several audio tracks
+	multiAudio bool
+
+	// the yt-dlp arguments to get the container when it is preferred or forced
+	preferArgs []string
+	forceArgs  []string
+
+	// the ffmpeg audio codec for re-encoded clips, "" keeps the audio as is
+	clipAudioCodec string
+
+	// the encoder of forced clips when the configured one makes a codec the container can't hold, "" if any works
+	clipEncoder string
+}
+
+// containers maps the supported containers to their spec
+var containers = map[string]containerSpec{
+	// MP4 holds every codec the sites use (H.264, H.265, VP9, AV1, AAC, Opus)
+	"mp4": {
+		videoExt:   "mp4",
+		audioExt:   "m4a",
+		remuxesAll: true,
+		multiAudio: true,
+		forceArgs:  []string{"--remux-video", "mp4"},
+	},
+	// MKV holds everything, including all audio and subtitle tracks, so it never needs conversion
+	"mkv": {
+		remuxesAll: true,
+		multiAudio: true,
+		preferArgs: []string{"--merge-output-format", "mkv"},
+		forceArgs:  []string{"--remux-video", "mkv"},
+	},
+	// WebM only holds VP8, VP9 and AV1 with Opus or Vorbis, other streams have to be re-encoded.
+	// Browsers only play its first audio track, so all audio tracks are not kept.
+	"webm": {
+		videoExt:       "webm",
+		audioExt:       "webm",
+		codecs:         []string{"vp9", "av1", "vp8"},
+		forceArgs:      []string{"--recode-video", "mp4>webm/mkv>webm/mov>webm"},
+		clipAudioCodec: "libopus",
+		clipEncoder:    config.VP9Encoder,
+	},
+	// MOV holds H.264 and H.265 with AAC, so only MP4 downloads with those codecs can be remuxed.
+	// VP9, AV1 and Opus (in WebM and MKV downloads) have to be re-encoded, ffmpeg re-encodes them
+	// to H.264 and AAC. MP4 downloads with other codecs are never selected (see buildFormatPrefer and
+	// buildFormatForce), since they would be remuxed as they are: when MOV is preferred they are kept in MKV.
+	"mov": {
+		videoExt:       "mp4",
+		audioExt:       "m4a",
+		audioCodec:     "mp4a",
+		codecs:         []string{"h264", "h265"},
+		multiAudio:     true,
+		preferArgs:     []string{"--remux-video", "mp4>mov"},
+		forceArgs:      []string{"--remux-video", "mp4>mov", "--recode-video", "webm>mov/mkv>mov"},
+		clipAudioCodec: "aac",
+		clipEncoder:    config.CPUEncoder,
+	},
+}
+
+// supportsAudioTracks returns true if the chosen container can hold several audio tracks.
+// Without a container, yt-dlp picks one that can.
+func supportsAudioTracks(videoFormat models.VideoFormat) bool {
+	spec, ok := containers[videoFormat.Container]
+	return !ok || spec.multiAudio
+}
+
+// audioTrackArgs returns the yt-dlp arguments needed to merge several audio tracks
+func audioTrackArgs(prefs models.FormatPreferences) []string {
+	if !prefs.AllAudioTracks {
+		return nil
+	}
+
+	// yt-dlp tags each merged track with the language of its format
+	return []string{"--audio-multistreams"}
+}
+
+// containerArgs returns the yt-dlp arguments that remux, merge or re-encode the video into the chosen container
+func containerArgs(videoFormat models.VideoFormat) []string {
+	spec, ok := containers[videoFormat.Container]
+	if !ok {
+		return nil
+	}
+
+	if videoFormat.Force {
+		return spec.forceArgs
+	}
+	return spec.preferArgs
+}
+
+// ClipEncoder returns the encoder that re-encodes clips into the chosen container, with its ffmpeg arguments.
+// A forced container that can't hold the codec of the encoder (e.g. AV1 in MOV) gets its own CPU encoder instead.
+func ClipEncoder(videoFormat models.VideoFormat, encoder string, encoderArgs []string) (string, []string) {
+	spec, ok := containers[videoFormat.Container]
+	if !ok || !videoFormat.Force || spec.clipEncoder == "" || slices.Contains(spec.codecs, config.EncoderCodec(encoder)) {
+		return encoder, encoderArgs
+	}
+	return spec.clipEncoder, nil
+}
+
+// clipReEncodeArgs returns the yt-dlp arguments to re-encode a clip with the encoder into the chosen container.
+// encoderArgs are the ffmpeg arguments the encoder needs besides -c:v (e.g. the VAAPI device).
+func clipReEncodeArgs(videoFormat models.VideoFormat, encoder string, encoderArgs []string) []string {
+	encoder, encoderArgs = ClipEncoder(videoFormat, encoder, encoderArgs)
+	ffmpegArgs := "ffmpeg=" + strings.Join(append(slices.Clone(encoderArgs), "-c:v", encoder), " ")
+
+	spec, ok := containers[videoFormat.Container]
+	if ok && spec.clipAudioCodec != "" {
+		ffmpegArgs += " -c:a " + spec.clipAudioCodec
+	}
+
+	args := []string{"--postprocessor-args", ffmpegArgs}
+
+	// the re-encoded streams are merged straight into the container
+	if ok && videoFormat.Force {
+		args = append(args, "--merge-output-format", videoFormat.Container)
+	}
+
+	return args
+}
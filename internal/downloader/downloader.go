@@ -2,30 +2,143 @@ package downloader
 
 import (
 	"downloader/internal/config"
+	"downloader/internal/dependencies"
 	"downloader/internal/models"
+	"downloader/internal/ui"
 	"downloader/internal/utils"
+	"errors"
 	"fmt"
 	"io"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Downloader struct {
 	config         *config.Config
 	ErrorCollector *errorCollector
+
+	// the directory holding the job logs of this run, empty if logs couldn't be created
+	runLogDir string
+
+	// the download slots of the sites with a concurrency limit, by profile name
+	slotsMu   sync.Mutex
+	siteSlots map[string]chan struct{}
+
+	// the download slots of all sites, nil if there is no limit
+	slots chan struct{}
+
+	// the running download processes, killed by Stop. No process starts once stopped is set.
+	processesMu sync.Mutex
+	processes   map[*exec.Cmd]struct{}
+	stopped     bool
 }
 
 func New(cfg *config.Config) *Downloader {
+	runLogDir, err := createRunLogDir(cfg.LogDir, cfg.KeepLogRuns)
+	if err != nil {
+		ui.Errorln(fmt.Sprintf("Download logs are disabled: %v", err))
+	}
+
+	var slots chan struct{}
+	if cfg.Concurrency > 0 {
+		slots = make(chan struct{}, cfg.Concurrency)
+	}
+
 	return &Downloader{
 		config:         cfg,
 		ErrorCollector: &errorCollector{},
+		runLogDir:      runLogDir,
+		siteSlots:      make(map[string]chan struct{}),
+		slots:          slots,
+		processes:      make(map[*exec.Cmd]struct{}),
 	}
 }
 
-func (d *Downloader) Download(videoRequest models.DownloadRequest) <-chan int {
+// RunLogDir returns the directory holding the job logs of this run, or "" if logging is disabled
+func (d *Downloader) RunLogDir() string {
+	return d.runLogDir
+}
 
-	var downloadCommand *exec.Cmd
+// Download starts downloading the request in the background.
+// It returns a channel that is closed when the download starts (it is queued until there is a free slot),
+// a channel with the progress percentage, a channel with the stalls the download was restarted after,
+// and a channel that receives the result (nil on success) once the progress and restart channels are closed.
+func (d *Downloader) Download(videoRequest models.DownloadRequest) (<-chan struct{}, <-chan int, <-chan *models.DownloadError, <-chan *models.DownloadError) {
+
+	startedChan := make(chan struct{})
 	progressChan := make(chan int)
+	restartChan := make(chan *models.DownloadError)
+	resultChan := make(chan *models.DownloadError, 1)
+
+	go func() {
+		release := d.acquireSlot(videoRequest.Url)
+		close(startedChan)
+
+		downloadErr := d.run(videoRequest, progressChan, restartChan)
+		release()
+
+		close(progressChan)
+		close(restartChan)
+		resultChan <- downloadErr
+	}()
+
+	return startedChan, progressChan, restartChan, resultChan
+}
+
+// run executes the download, restarting it when the watchdog kills a stalled process.
+// Every failure and stall is recorded in the error collector, and every restart is sent to restartChan.
+func (d *Downloader) run(videoRequest models.DownloadRequest, progressChan chan int, restartChan chan *models.DownloadError) *models.DownloadError {
+
+	log := d.openJobLog(videoRequest)
+
+	for attempt := 0; ; attempt++ {
+
+		downloadErr, stalled := d.runAttempt(videoRequest, progressChan, attempt, log)
+		if downloadErr == nil {
+			log.close("success")
+			return nil
+		}
+
+		downloadErr.LogFile = log.Path()
+		downloadErr.Attempt = attempt + 1
+
+		if !stalled {
+			log.close("failed: " + downloadErr.Message)
+			d.ErrorCollector.Add(downloadErr)
+			return downloadErr
+		}
+
+		if attempt >= d.config.StallRestarts {
+			downloadErr.Message += fmt.Sprintf(", giving up after %d restarts", attempt)
+			log.close("failed: " + downloadErr.Message)
+			d.ErrorCollector.Add(downloadErr)
+			return downloadErr
+		}
+
+		downloadErr.Message += fmt.Sprintf(", restarting (%d/%d)", attempt+1, d.config.StallRestarts)
+		downloadErr.Recovered = true
+		d.ErrorCollector.Add(downloadErr)
+		restartChan <- downloadErr
+	}
+}
+
+// runAttempt executes the download command once and streams its progress until the process exits.
+// stalled is true if the watchdog killed the process.
+func (d *Downloader) runAttempt(videoRequest models.DownloadRequest, progressChan chan int, attempt int, log *jobLog) (downloadErr *models.DownloadError, stalled bool) {
+
+	// Restarted full downloads continue from the partial data of the killed attempt
+	resume := attempt > 0
+
+	// Kill the process if it stops making progress or runs for too long
+	watchdog := newWatchdog(d.config.StallTimeout, d.config.JobTimeout)
+	output := newJobOutput(log, watchdog.touch)
+
+	var downloadCommand *exec.Cmd
+	var streamProgress func(stdoutPipe, stderrPipe io.ReadCloser)
 
 	// Build the download command based on the request type and setup progress tracking
 	if videoRequest.IsClip {
@@ -34,169 +147,288 @@ func (d *Downloader) Download(videoRequest models.DownloadRequest) <-chan int {
 		clipDurationInSeconds, err := utils.CalculateClipDurationInSeconds(videoRequest.ClipTimeRange)
 
 		if err != nil {
-			d.ErrorCollector.Add(fmt.Sprintf("failed to calculate clip duration: %v", err))
-			close(progressChan)
-			return progressChan
+			return output.failure(videoRequest, fmt.Sprintf("failed to calculate clip duration: %v", err), -1), false
 		}
 
 		// Build the download command
+		// Clips are cut by ffmpeg while downloading, so a restarted clip always starts from scratch
 		downloadCommand = d.buildClipDownloadCommand(videoRequest)
 
-		// Get the command pipes
-		stdoutPipe, stderrPipe, err := getCommandPipes(downloadCommand)
+		streamProgress = func(stdoutPipe, stderrPipe io.ReadCloser) {
+			d.streamClipDownloadProgress(stderrPipe, stdoutPipe, clipDurationInSeconds, progressChan, output)
+		}
+	} else {
+		downloadCommand = d.buildFullDownloadCommand(videoRequest, resume)
 
-		if err != nil {
-			d.ErrorCollector.Add(err.Error())
-			close(progressChan)
-			return progressChan
+		streamProgress = func(stdoutPipe, stderrPipe io.ReadCloser) {
+			d.streamFullDownloadProgress(stderrPipe, stdoutPipe, progressChan, output)
 		}
+	}
 
-		// Start the progress tracking
-		go d.streamClipDownloadProgress(stderrPipe, stdoutPipe, clipDurationInSeconds, progressChan)
+	// each attempt gets its own copy of the cookie file, the cookies refreshed by a successful attempt are saved back
+	cookies, err := isolateCookieFile(downloadCommand)
+	if err != nil {
+		return output.failure(videoRequest, err.Error(), -1), false
+	}
+	defer func() { cookies.finish(downloadErr == nil) }()
+
+	// Get the command pipes
+	stdoutPipe, stderrPipe, err := getCommandPipes(downloadCommand)
+
+	if err != nil {
+		return output.failure(videoRequest, err.Error(), -1), false
+	}
+
+	// Start the download
+	output.setPhase(models.PhaseStart)
+	log.startAttempt(attempt, downloadCommand)
+	attemptStarted := time.Now()
+
+	err = d.startProcess(downloadCommand)
+
+	if err != nil {
+		log.endAttempt(downloadCommand, attemptStarted, err.Error())
+		return output.failure(videoRequest, fmt.Sprintf("failed to start download: %v", err), -1), false
+	}
+
+	go watchdog.watch(downloadCommand)
+	output.setPhase(models.PhaseExtract)
+
+	// Track the progress until the output is closed, then clean up process resources
+	streamProgress(stdoutPipe, stderrPipe)
+	err = downloadCommand.Wait()
+	watchdog.stop()
+	d.untrackProcess(downloadCommand)
+
+	if reason := watchdog.firedReason(); reason != "" {
+		log.endAttempt(downloadCommand, attemptStarted, "killed, download "+reason)
+		return output.failure(videoRequest, "download "+reason, -1), true
+	}
+
+	if err != nil {
+		log.endAttempt(downloadCommand, attemptStarted, err.Error())
 	} else {
-		downloadCommand = d.buildFullDownloadCommand(videoRequest)
+		log.endAttempt(downloadCommand, attemptStarted, "ok")
+	}
 
-		// Get the command pipes
-		stdoutPipe, stderrPipe, err := getCommandPipes(downloadCommand)
+	// yt-dlp exits with a failure status when the download fails,
+	// usually after printing an ERROR line which is used as the message
+	exitCode := downloadCommand.ProcessState.ExitCode()
 
-		if err != nil {
-			d.ErrorCollector.Add(err.Error())
-			close(progressChan)
-			return progressChan
+	if err != nil || output.last() != "" {
+		message := ""
+		if output.last() == "" {
+			message = fmt.Sprintf("yt-dlp failed without an error message: %v", err)
 		}
+		return output.failure(videoRequest, message, exitCode), false
+	}
+
+	return nil, false
+}
 
-		// Start the progress tracking
-		go d.streamFullDownloadProgress(stderrPipe, stdoutPipe, progressChan)
+// startProcess starts the command in its own process group, so the ffmpeg processes spawned by yt-dlp
+// can be killed with it, and tracks it until untrackProcess is called
+func (d *Downloader) startProcess(cmd *exec.Cmd) error {
+	d.processesMu.Lock()
+	defer d.processesMu.Unlock()
+
+	if d.stopped {
+		return errors.New("the downloads were stopped")
 	}
 
-	// Start the download
-	err := downloadCommand.Start()
+	startInProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	d.processes[cmd] = struct{}{}
+	return nil
+}
 
-	if err != nil {
-		d.ErrorCollector.Add(fmt.Sprintf("failed to start download: %v", err))
-		close(progressChan)
-		return progressChan
+func (d *Downloader) untrackProcess(cmd *exec.Cmd) {
+	d.processesMu.Lock()
+	defer d.processesMu.Unlock()
+	delete(d.processes, cmd)
+}
+
+// Stop kills the running downloads with their ffmpeg processes and keeps new ones from starting.
+// The processes are in their own process groups, so Ctrl+C doesn't reach them: the app calls Stop
+// when it is interrupted, otherwise they would keep downloading after it exits.
+func (d *Downloader) Stop() {
+	d.processesMu.Lock()
+	defer d.processesMu.Unlock()
+
+	d.stopped = true
+	for cmd := range d.processes {
+		killProcessTree(cmd)
 	}
+}
 
-	// Clean up process resources and close the progress channel when the download is finished
-	go func() {
-		downloadCommand.Wait()
-		close(progressChan)
-	}()
+// CommandLine returns the yt-dlp command line of the request with the secrets hidden, as it would run on
+// the first attempt. It is used by dry runs, nothing is downloaded.
+func CommandLine(cfg *config.Config, req models.DownloadRequest) string {
+	d := &Downloader{config: cfg}
 
-	return progressChan
+	var cmd *exec.Cmd
+	if req.IsClip {
+		cmd = d.buildClipDownloadCommand(req)
+	} else {
+		cmd = d.buildFullDownloadCommand(req, false)
+	}
+	return formatCommandLine(cmd.Args)
 }
 
-// prepare the command to download the whole video
-func (d *Downloader) buildFullDownloadCommand(req models.DownloadRequest) *exec.Cmd {
+// prepare the command to download the whole video.
+// If resume is true, the partial files of a previous attempt are reused instead of being overwritten.
+func (d *Downloader) buildFullDownloadCommand(req models.DownloadRequest, resume bool) *exec.Cmd {
+	cfg := d.config.ForRequest(req)
 
 	var downloadPath string
 	var format string
+	var prefs models.FormatPreferences
+	var audioOutput models.AudioOutput
+	site := cfg.Sites.Match(req.Url)
 
 	if req.IsAudioOnly {
-		// yt-dlp output template for audio: "%(title).150s-audio.%(ext)s"
-		downloadPath = filepath.Join(d.config.DownloadPath, "%(title).150s-audio.%(ext)s")
-		format = "ba"
+		// default yt-dlp output template for audio: "%(title).150s-{audio}.%(ext)s",
+		// {audio} is replaced by a suffix showing the chosen format, e.g. "audio-mp3-192k"
+		audioOutput = cfg.AudioOutput.WithOverrides(req.AudioOutput)
+		downloadPath = filepath.Join(cfg.DownloadPath, strings.ReplaceAll(cfg.AudioTemplate, "{audio}", audioFileSuffix(audioOutput)))
+		format = getYtdlpAudioFormat(cfg.FormatPreferences.WithOverrides(req.Preferences).AudioLanguages)
 	} else {
-		// yt-dlp output template: "%(title).150s-%(height)sp.%(ext)s"
+		// default yt-dlp output template: "%(title).150s-%(height)sp.%(ext)s"
 		// - %(title)s: video title from metadata
 		// - .150s: limits title to 150 characters to avoid filename length issues
 		// - %(height)sp: adds resolution height (e.g., 1080p, 720p)
 		// - %(ext)s: file extension based on selected format
-		downloadPath = filepath.Join(d.config.DownloadPath, "%(title).150s-%(height)sp.%(ext)s")
+		downloadPath = filepath.Join(cfg.DownloadPath, cfg.VideoTemplate)
 
-		isYoutubeUrl := utils.IsYouTubeURL(req.Url)
-		format = getYtdlpFormat(isYoutubeUrl, req.Quality, d.config.VideoFormat)
+		prefs = cfg.FormatPreferences.WithOverrides(req.Preferences)
+		prefs.AllAudioTracks = prefs.AllAudioTracks && supportsAudioTracks(cfg.VideoFormat)
+		format = getYtdlpFormat(site.PrefersSeparateStreams(), req.Quality, cfg.VideoFormat, prefs)
 	}
 
 	args := []string{
 		"-f", format,
-		"--user-agent", "random",
+		"--user-agent", site.UserAgent,
 		"--no-playlist",
-		"--audio-quality", "0",
 		"--socket-timeout", "20",
 		"--retries", "3",
 		"--retry-sleep", "3",
-		"--force-overwrites",
-		"--concurrent-fragments", "3",
+		"--concurrent-fragments", strconv.Itoa(site.FragmentConcurrency),
 		"--buffer-size", "64K",
 		"--newline",
-		"--ffmpeg-location", utils.GetBinaryPath("ffmpeg"),
-		"--js-runtimes", utils.GetBinaryPath("deno"),
+		"--ffmpeg-location", dependencies.BinaryPath("ffmpeg"),
+		"--js-runtimes", dependencies.BinaryPath("deno"),
 		"-o", downloadPath,
 	}
 
-	if !req.IsAudioOnly && d.config.VideoFormat == models.FormatForceMP4 {
-		args = append(args, "--remux-video", "mp4")
+	// --force-overwrites implies --no-continue, so it must be dropped to resume a partial download
+	if resume {
+		args = append(args, "--continue")
+	} else {
+		args = append(args, "--force-overwrites")
 	}
 
+	if req.IsAudioOnly {
+		args = append(args, audioArgs(audioOutput)...)
+	} else {
+		args = append(args, containerArgs(cfg.VideoFormat)...)
+	}
+
+	args = append(args, getYtdlpSortArgs(req.Quality, prefs)...)
+	args = append(args, audioTrackArgs(prefs)...)
+	args = append(args, d.verbosityArgs()...)
+	args = append(args, authArgs(cfg, site)...)
+	args = append(args, proxyArgs(cfg, site, req.Url)...)
+	args = append(args, site.Args()...)
 	args = append(args, req.Url)
 
-	return exec.Command(utils.GetBinaryPath("yt-dlp"), args...)
+	return exec.Command(dependencies.BinaryPath("yt-dlp"), args...)
 }
 
 // prepare the command to download a clip of the video
 func (d *Downloader) buildClipDownloadCommand(req models.DownloadRequest) *exec.Cmd {
+	cfg := d.config.ForRequest(req)
 
 	var downloadPath string
 	var format string
+	var prefs models.FormatPreferences
+	var audioOutput models.AudioOutput
+	site := cfg.Sites.Match(req.Url)
 
 	if req.IsAudioOnly {
-		// yt-dlp output template for audio: "%(title).150s-audio.%(ext)s"
-		downloadPath = filepath.Join(d.config.DownloadPath, "%(title).150s-audio.%(ext)s")
-		format = "ba"
+		// default yt-dlp output template for audio: "%(title).150s-{audio}.%(ext)s",
+		// {audio} is replaced by a suffix showing the chosen format, e.g. "audio-mp3-192k"
+		audioOutput = cfg.AudioOutput.WithOverrides(req.AudioOutput)
+		downloadPath = filepath.Join(cfg.DownloadPath, strings.ReplaceAll(cfg.AudioTemplate, "{audio}", audioFileSuffix(audioOutput)))
+		format = getYtdlpAudioFormat(cfg.FormatPreferences.WithOverrides(req.Preferences).AudioLanguages)
 	} else {
 		// Prepare the download path with the video title
-		// yt-dlp output template: "%(title).150s-%(height)sp.%(ext)s"
+		// default yt-dlp output template: "%(title).150s-%(height)sp.%(ext)s"
 		// - %(title)s: video title from metadata
 		// - .150s: limits title to 150 characters to avoid filename length issues
 		// - %(height)sp: adds resolution height (e.g., 1080p, 720p)
 		// - %(ext)s: file extension based on selected format
-		downloadPath = filepath.Join(d.config.DownloadPath, "%(title).150s-%(height)sp.%(ext)s")
+		downloadPath = filepath.Join(cfg.DownloadPath, cfg.VideoTemplate)
 
-		isYouTubeURL := utils.IsYouTubeURL(req.Url)
-		format = getYtdlpFormat(isYouTubeURL, req.Quality, d.config.VideoFormat)
+		prefs = cfg.FormatPreferences.WithOverrides(req.Preferences)
+		prefs.AllAudioTracks = prefs.AllAudioTracks && supportsAudioTracks(cfg.VideoFormat)
+		format = getYtdlpFormat(site.PrefersSeparateStreams(), req.Quality, cfg.VideoFormat, prefs)
 	}
 
 	// Prepare the command arguments
 	args := []string{
 		"-f", format,
 		"--download-sections", fmt.Sprintf("*%s", req.ClipTimeRange),
-		"--user-agent", "random",
+		"--user-agent", site.UserAgent,
 		"--no-playlist",
-		"--audio-quality", "0",
 		"--socket-timeout", "20",
 		"--retries", "3",
 		"--retry-sleep", "3",
 		"--force-overwrites",
-		"--concurrent-fragments", "3",
+		"--concurrent-fragments", strconv.Itoa(site.FragmentConcurrency),
 		"--buffer-size", "64K",
 		"--newline",
-		"--ffmpeg-location", utils.GetBinaryPath("ffmpeg"),
-		"--js-runtimes", utils.GetBinaryPath("deno"),
+		"--ffmpeg-location", dependencies.BinaryPath("ffmpeg"),
+		"--js-runtimes", dependencies.BinaryPath("deno"),
 		"-o", downloadPath,
 	}
 
-	// Audio clips don't need re-encoding or remuxing
-	if !req.IsAudioOnly {
-		// If the user choose to re-encode clips, add --postprocessor-args to force re-encoding with the selected encoder
-		if d.config.ShouldReEncode {
-			args = append(args, "--postprocessor-args", fmt.Sprintf("ffmpeg=-c:v %s", d.config.Encoder))
+	args = append(args, getYtdlpSortArgs(req.Quality, prefs)...)
+	args = append(args, audioTrackArgs(prefs)...)
+	args = append(args, d.verbosityArgs()...)
 
-			if d.config.VideoFormat == models.FormatForceMP4 {
-				args = append(args, "--merge-output-format", "mp4")
-			}
+	// Audio clips are only converted to the chosen audio format, they don't need re-encoding or remuxing
+	if req.IsAudioOnly {
+		args = append(args, audioArgs(audioOutput)...)
+	} else {
+		// If the user choose to re-encode clips, add --postprocessor-args to force re-encoding with the selected encoder
+		if cfg.ShouldReEncode {
+			args = append(args, clipReEncodeArgs(cfg.VideoFormat, cfg.Encoder, cfg.EncoderArgs)...)
 		} else {
-			// Only remux if not re-encoding
-			if d.config.VideoFormat == models.FormatForceMP4 {
-				args = append(args, "--remux-video", "mp4")
-			}
+			// Only remux (or convert) if not re-encoding
+			args = append(args, containerArgs(cfg.VideoFormat)...)
 		}
 	}
 
+	args = append(args, authArgs(cfg, site)...)
+	args = append(args, proxyArgs(cfg, site, req.Url)...)
+	args = append(args, site.Args()...)
 	args = append(args, req.Url)
 
-	return exec.Command(utils.GetBinaryPath("yt-dlp"), args...)
+	return exec.Command(dependencies.BinaryPath("yt-dlp"), args...)
+}
+
+// verbosityArgs returns the yt-dlp arguments for the configured log verbosity
+func (d *Downloader) verbosityArgs() []string {
+	switch {
+	case d.config.Verbosity >= 2:
+		return []string{"--verbose", "--print-traffic"}
+	case d.config.Verbosity == 1:
+		return []string{"--verbose"}
+	default:
+		return nil
+	}
 }
 
 func getCommandPipes(cmd *exec.Cmd) (stdoutPipe, stderrPipe io.ReadCloser, err error) {
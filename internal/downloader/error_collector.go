@@ -1,20 +1,23 @@
 package downloader
 
-import "sync"
+import (
+	"downloader/internal/models"
+	"sync"
+)
 
 // errorCollector safely collects errors from concurrent downloads
 type errorCollector struct {
 	mu     sync.Mutex
-	errors []string
+	errors []*models.DownloadError
 }
 
-func (ec *errorCollector) Add(err string) {
+func (ec *errorCollector) Add(err *models.DownloadError) {
 	ec.mu.Lock()
 	defer ec.mu.Unlock()
 	ec.errors = append(ec.errors, err)
 }
 
-func (ec *errorCollector) GetAll() []string {
+func (ec *errorCollector) GetAll() []*models.DownloadError {
 	ec.mu.Lock()
 	defer ec.mu.Unlock()
 	return ec.errors
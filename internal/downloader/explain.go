@@ -0,0 +1,115 @@
+package downloader
+
+import (
+	"downloader/internal/models"
+	"regexp"
+	"strings"
+)
+
+// errorRule maps a known error pattern to a plain-language explanation
+type errorRule struct {
+	pattern     *regexp.Regexp
+	explanation models.ErrorExplanation
+}
+
+func rule(pattern, category, explanation, suggestion string) errorRule {
+	return errorRule{
+		pattern: regexp.MustCompile("(?i)" + pattern),
+		explanation: models.ErrorExplanation{
+			Category:    category,
+			Explanation: explanation,
+			Suggestion:  suggestion,
+		},
+	}
+}
+
+// errorRules are checked in order and the first match wins, so specific patterns come before generic ones
+var errorRules = []errorRule{
+	rule(`confirm you.?re not a bot`,
+		"Bot check",
+		"The site suspects the downloads come from a bot and asks you to sign in.",
+		"Provide cookies from a browser where you are signed in to the site, or wait a few hours and retry."),
+	rule(`confirm your age|age.restricted|inappropriate for some users`,
+		"Age restricted",
+		"The video is age restricted and can only be watched by signed in adults.",
+		"Provide cookies from a browser where you are signed in with an adult account."),
+	rule(`members.only|join this channel|available to this channel's members|subscriber.only`,
+		"Members only",
+		"The video is only available to paying members or subscribers of the channel.",
+		"Provide cookies from a browser where you are signed in with an account that has access."),
+	rule(`private video|video is private`,
+		"Private video",
+		"The owner made the video private, only accounts they shared it with can watch it.",
+		"Provide cookies from a browser where you are signed in with an account that has access."),
+	rule(`not available in your country|blocked it in your country|geo.?restrict|not available from your location`,
+		"Region blocked",
+		"The video is not available in the country you are downloading from.",
+		"Use a proxy or VPN located in a country where the video is available."),
+	rule(`premieres in|live event will begin|this live event|is upcoming`,
+		"Not started yet",
+		"The video is a premiere or live stream that hasn't started yet.",
+		"Wait until it has started (or finished) and retry."),
+	rule(`requested format is not available|no video formats found`,
+		"Format unavailable",
+		"The site has no stream matching the requested quality or format.",
+		"Lower the quality (or remove it from the line), or choose \"Any format\" instead of a specific one."),
+	rule(`ffmpeg.*not found|ffprobe.*not found|postprocessing: .*ffmpeg`,
+		"ffmpeg problem",
+		"ffmpeg, which is needed to merge and convert files, failed or is missing.",
+		"Delete ffmpeg from the bin folder so the app downloads it again."),
+	rule(`HTTP Error 429|too many requests`,
+		"Rate limited",
+		"The site received too many requests in a short time and is temporarily refusing new ones.",
+		"Wait a while (up to an hour) and retry, or download fewer videos at once."),
+	rule(`HTTP Error 403|403: forbidden`,
+		"Access denied",
+		"The server refused the download. This usually means an expired link, a region block or rate limiting.",
+		"Wait a few minutes and retry. If it keeps failing, update yt-dlp or provide cookies."),
+	rule(`HTTP Error 404|404: not found`,
+		"Not found",
+		"The page or video doesn't exist (anymore).",
+		"Check that the URL is correct and the video still exists."),
+	rule(`video unavailable|this video is unavailable|has been removed|account.*terminated`,
+		"Unavailable",
+		"The video was removed or its account was closed.",
+		"Nothing can be done from this app, remove the line from urls.txt."),
+	rule(`unsupported url`,
+		"Unsupported site",
+		"yt-dlp doesn't know how to download from this URL.",
+		"Check the URL. If it is a page with an embedded video, try the URL of the video itself."),
+	rule(`stalled|timed out \(running`,
+		"Stalled",
+		"The download stopped making progress and was stopped.",
+		"Retry later. If it keeps happening, check your internet connection or increase -stall-timeout."),
+	rule(`timed out|connection reset|connection refused|name resolution|getaddrinfo|network is unreachable|unable to download webpage`,
+		"Network problem",
+		"The site couldn't be reached or the connection was interrupted.",
+		"Check your internet connection and retry."),
+	rule(`no space left on device|disk full`,
+		"Disk full",
+		"There is not enough free space to save the file.",
+		"Free some disk space or choose another folder with -path."),
+	rule(`permission denied|access is denied`,
+		"Permission denied",
+		"The app isn't allowed to write to the download folder.",
+		"Choose a folder you can write to with -path."),
+	rule(`clip duration|invalid (start|end) time`,
+		"Invalid time range",
+		"The time range of the clip couldn't be read.",
+		"Write the range as HH:MM:SS-HH:MM:SS, for example 00:01:30-00:02:45."),
+}
+
+// explainError returns the explanation of the first rule matching the message or the stderr output,
+// or nil if the error is unknown
+func explainError(message string, stderrTail []string) *models.ErrorExplanation {
+	text := message + "\n" + strings.Join(stderrTail, "\n")
+
+	for _, r := range errorRules {
+		if r.pattern.MatchString(text) {
+			explanation := r.explanation
+			return &explanation
+		}
+	}
+
+	return nil
+}
@@ -3,55 +3,256 @@ package downloader
 import (
 	"downloader/internal/models"
 	"fmt"
+	"strings"
 )
 
-func getYtdlpFormat(isYouTubeUrl bool, quality string, videoFormat models.VideoFormat) string {
+// codecPatterns maps the canonical codec names to the start of the yt-dlp vcodec values
+var codecPatterns = map[string]string{
+	"h264": "avc|h264",
+	"h265": "hvc|hev|h265",
+	"vp9":  "vp0?9",
+	"vp8":  "vp0?8",
+	"av1":  "av01",
+}
+
+// codecSortNames maps the canonical codec names to the names used by yt-dlp -S
+var codecSortNames = map[string]string{
+	"h264": "h264",
+	"h265": "h265",
+	"vp9":  "vp9",
+	"av1":  "av01",
+}
+
+// codecFilter returns the yt-dlp filter accepting any of the codecs, e.g. "[vcodec~='^(avc|h264)']"
+func codecFilter(codecs ...string) string {
+	if len(codecs) == 0 {
+		return ""
+	}
+
+	patterns := make([]string, len(codecs))
+	for i, codec := range codecs {
+		patterns[i] = codecPatterns[codec]
+	}
+	return fmt.Sprintf("[vcodec~='^(%s)']", strings.Join(patterns, "|"))
+}
+
+func getYtdlpFormat(preferSeparate bool, quality models.Quality, videoFormat models.VideoFormat, prefs models.FormatPreferences) string {
 
-	// Build format string based on platform and format preference
-	switch videoFormat {
-	case models.FormatAny:
-		return buildFormatAny(isYouTubeUrl, quality)
-	case models.FormatPreferMP4:
-		return buildFormatPreferMP4(isYouTubeUrl, quality)
-	case models.FormatForceMP4:
-		return buildFormatForceMP4(isYouTubeUrl, quality)
+	filters := videoFilterChain(quality, prefs)
+
+	// Build format string based on platform and container preference.
+	// Containers without matching streams (MKV) and forced containers that can be remuxed from anything
+	// accept any stream, the others prefer the streams that fit them so they don't need re-encoding.
+	audio := audioVariants(prefs)
+
+	spec, ok := containers[videoFormat.Container]
+	switch {
+	case !ok || spec.videoExt == "" || (videoFormat.Force && spec.remuxesAll):
+		return buildFormatAny(preferSeparate, filters, audio)
+	case videoFormat.Force && len(spec.codecs) > 0:
+		return buildFormatForce(preferSeparate, filters, audio, spec)
 	default:
-		return buildFormatAny(isYouTubeUrl, quality)
+		return buildFormatPrefer(preferSeparate, filters, audio, spec)
 	}
 }
 
-// Youtube often seperate the audio and video streams, so we need to prefer seperate streams to get the required video quality.
-//
-// For other sites, we can prefer the merged stream.
-func buildFormatAny(isYouTube bool, quality string) string {
-	if isYouTube {
-		if quality != "" {
-			return fmt.Sprintf("bv*[height<=%[1]s]+ba/best[height<=%[1]s]/bv*+ba/best", quality)
+// getYtdlpAudioFormat returns the format of audio-only downloads: the best audio in the first available preferred language
+func getYtdlpAudioFormat(languages []string) string {
+	var alternatives []string
+	for _, language := range languages {
+		alternatives = append(alternatives, fmt.Sprintf("ba[language^=%s]", language))
+	}
+	return strings.Join(append(alternatives, "ba"), "/")
+}
+
+// audioVariants returns the audio selectors that replace "+ba" in the format alternatives, from the most wanted:
+// all the audio tracks, or the best audio in each preferred language, then the best audio in any language
+func audioVariants(prefs models.FormatPreferences) []string {
+	if prefs.AllAudioTracks {
+		return []string{"+mergeall[vcodec=none]", "+ba"}
+	}
+
+	var variants []string
+	for _, language := range prefs.AudioLanguages {
+		variants = append(variants, fmt.Sprintf("+ba[language^=%s]", language))
+	}
+	return append(variants, "+ba")
+}
+
+// getYtdlpSortArgs returns the -S arguments that make yt-dlp prefer the requested quality order, codecs and frame rate
+// when several streams pass the format filters. Resolution stays the most important sort key, except:
+//   - "smallest" sorts by file size and "worst" by resolution, both from the lowest
+//   - a size limit sorts by file size first, so the largest file under the limit is picked,
+//     or the smallest one above it when no format fits (the filters already tried the other constraints)
+func getYtdlpSortArgs(quality models.Quality, prefs models.FormatPreferences) []string {
+	var keys []string
+
+	switch quality.Order {
+	case "smallest":
+		keys = append(keys, "+size", "+br", "+res", "+fps")
+	case "worst":
+		keys = append(keys, "+res", "+fps")
+	default:
+		if quality.MaxSize > 0 {
+			keys = append(keys, fmt.Sprintf("size:%d", quality.MaxSize))
 		}
-		return "bv*+ba/best"
+		keys = append(keys, "res")
+	}
+
+	if prefs.MaxFPS > 0 {
+		keys = append(keys, fmt.Sprintf("fps:%d", prefs.MaxFPS))
 	}
 
-	if quality != "" {
-		return fmt.Sprintf("best[height<=%[1]s]/bv*[height<=%[1]s]+ba/best/bv*+ba", quality)
+	if len(prefs.Codecs) > 0 {
+		keys = append(keys, "vcodec:"+codecSortNames[prefs.Codecs[0]])
 	}
-	return "best/bv*+ba"
+
+	// the default order needs no -S
+	if len(keys) == 1 {
+		return nil
+	}
+
+	return []string{"-S", strings.Join(keys, ",")}
 }
 
-func buildFormatPreferMP4(isYouTube bool, quality string) string {
-	if isYouTube {
-		if quality != "" {
-			return fmt.Sprintf("bv*[height<=%[1]s][ext=mp4]+ba[ext=m4a]/bv*[height<=%[1]s]+ba/best[height<=%[1]s]/bv*[ext=mp4]+ba[ext=m4a]/bv*+ba/best", quality)
+// videoFilterChain returns the filters to try for the video stream, from the strictest to none.
+// The preferences are dropped one by one (codecs in order, then frame rate, bitrate and dynamic range)
+// so a video that can't satisfy them is still downloaded. The quality is dropped last:
+// first the minimum height, then the height ceiling and size limit together.
+func videoFilterChain(quality models.Quality, prefs models.FormatPreferences) []string {
+
+	// '?' accepts streams that don't report their size, most sites only report one of the two fields
+	sizeFilter := ""
+	if quality.MaxSize > 0 {
+		sizeFilter = fmt.Sprintf("[filesize<?%[1]d][filesize_approx<?%[1]d]", quality.MaxSize)
+	}
+
+	maxFilter := sizeFilter
+	if quality.MaxHeight > 0 {
+		maxFilter = fmt.Sprintf("[height<=%d]", quality.MaxHeight) + sizeFilter
+	}
+
+	qualityFilter := maxFilter
+	if quality.MinHeight > 0 {
+		qualityFilter = fmt.Sprintf("[height>=%d]", quality.MinHeight) + maxFilter
+	}
+
+	// the preference filters except the codec, '?' also accepts streams that don't report the field
+	prefFilters := ""
+	if prefs.MaxFPS > 0 {
+		prefFilters += fmt.Sprintf("[fps<=?%d]", prefs.MaxFPS)
+	}
+	if prefs.MaxBitrate > 0 {
+		prefFilters += fmt.Sprintf("[tbr<=?%d]", prefs.MaxBitrate)
+	}
+	switch prefs.DynamicRange {
+	case "sdr":
+		prefFilters += "[dynamic_range=?SDR]"
+	case "hdr":
+		prefFilters += "[dynamic_range!=SDR]"
+	}
+
+	var chain []string
+	for _, codec := range prefs.Codecs {
+		chain = append(chain, qualityFilter+prefFilters+codecFilter(codec))
+	}
+	chain = append(chain, qualityFilter+prefFilters, qualityFilter, maxFilter, "")
+
+	return uniqueFilters(chain)
+}
+
+// uniqueFilters removes repeated filters, keeping the first occurrence
+func uniqueFilters(filters []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, f := range filters {
+		if !seen[f] {
+			seen[f] = true
+			unique = append(unique, f)
+		}
+	}
+	return unique
+}
+
+// joinFormats builds the format alternatives of each filter with the template and joins them with "/".
+// Every %[1]s in the template is replaced by the filter, and every alternative merging "+ba"
+// is repeated for each audio variant (e.g. "+ba[language^=ar]", "+ba").
+func joinFormats(template string, filters []string, audio []string) string {
+	var alternatives []string
+	for _, f := range filters {
+		for _, alternative := range strings.Split(fmt.Sprintf(template, f), "/") {
+			if !strings.Contains(alternative, "+ba") {
+				alternatives = append(alternatives, alternative)
+				continue
+			}
+			for _, variant := range audio {
+				alternatives = append(alternatives, strings.Replace(alternative, "+ba", variant, 1))
+			}
+		}
+	}
+	return strings.Join(alternatives, "/")
+}
+
+// Youtube (and other sites with the "separate" strategy) often seperate the audio and video streams,
+// so we need to prefer seperate streams to get the required video quality.
+//
+// For other sites, we can prefer the merged stream.
+func buildFormatAny(preferSeparate bool, filters []string, audio []string) string {
+	if preferSeparate {
+		return joinFormats("bv*%[1]s+ba/best%[1]s", filters, audio)
+	}
+
+	return joinFormats("best%[1]s/bv*%[1]s+ba", filters, audio)
+}
+
+// For each filter, the streams that fit the container are tried first, then any stream,
+// so the video is still downloaded when the site doesn't offer the container.
+func buildFormatPrefer(preferSeparate bool, filters []string, audio []string, spec containerSpec) string {
+	video := fmt.Sprintf("[ext=%s]", spec.videoExt) + codecFilter(spec.codecs...)
+
+	// The preferArgs of MOV remux every MP4 download, so an MP4 stream with a codec MOV can't hold (e.g. AV1)
+	// is only taken with audio in another extension: yt-dlp merges them into MKV, which keeps its codecs.
+	// The other streams stay in their own container.
+	if len(spec.preferArgs) > 0 && len(spec.codecs) > 0 {
+		otherExt := fmt.Sprintf("[ext!=%s]", spec.videoExt)
+		separate := "bv*%[1]s" + video + "+ba[ext=" + spec.audioExt + "]/bv*%[1]s" + otherExt + "+ba/bv*%[1]s+ba[ext!=" + spec.audioExt + "]"
+		merged := "best%[1]s" + video + "/best%[1]s" + otherExt
+
+		if preferSeparate {
+			return joinFormats(separate+"/"+merged, filters, audio)
 		}
-		return "bv*[ext=mp4]+ba[ext=m4a]/bv*+ba/best"
+		return joinFormats(merged+"/"+separate, filters, audio)
 	}
 
-	if quality != "" {
-		return fmt.Sprintf("best[height<=%[1]s][ext=mp4]/best[height<=%[1]s]/best[ext=mp4]/best", quality)
+	if preferSeparate {
+		return joinFormats("bv*%[1]s"+video+"+ba[ext="+spec.audioExt+"]/bv*%[1]s+ba/best%[1]s", filters, audio)
 	}
-	return "best[ext=mp4]/best"
+
+	return joinFormats("best%[1]s"+video+"/best%[1]s", filters, audio)
 }
 
-func buildFormatForceMP4(isYouTube bool, quality string) string {
-	// Force MP4 uses same format as "Any" but adds --remux-video mp4 flag
-	return buildFormatAny(isYouTube, quality)
+// buildFormatForce builds the format of a forced container that can't hold every codec (MOV, WebM).
+// For each filter, the streams that fit the container are tried first, then the streams with a codec
+// it holds, then the streams in another extension, which the forceArgs re-encode. There is no fallback
+// to any stream: a stream in the container's own extension with another codec (e.g. AV1 in MP4 for MOV)
+// would only be remuxed and give an unplayable file, so the download fails instead.
+func buildFormatForce(preferSeparate bool, filters []string, audio []string, spec containerSpec) string {
+	ext := fmt.Sprintf("[ext=%s]", spec.videoExt)
+	otherExt := fmt.Sprintf("[ext!=%s]", spec.videoExt)
+	codec := codecFilter(spec.codecs...)
+
+	audioCodec := ""
+	if spec.audioCodec != "" {
+		audioCodec = fmt.Sprintf("[acodec^=%s]", spec.audioCodec)
+	}
+
+	// yt-dlp merges streams of different extensions into MKV, which is re-encoded too
+	separate := "bv*%[1]s" + ext + codec + "+ba[ext=" + spec.audioExt + "]" + audioCodec +
+		"/bv*%[1]s" + codec + "+ba/bv*%[1]s" + otherExt + "+ba"
+	merged := "best%[1]s" + ext + codec + audioCodec + "/best%[1]s" + otherExt
+
+	if preferSeparate {
+		return joinFormats(separate+"/"+merged, filters, audio)
+	}
+	return joinFormats(merged+"/"+separate, filters, audio)
 }
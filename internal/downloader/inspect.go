@@ -0,0 +1,123 @@
+package downloader
+
+import (
+	"bytes"
+	"downloader/internal/config"
+	"downloader/internal/dependencies"
+	"downloader/internal/models"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ytdlpInfo is the part of the yt-dlp -J output needed to list the formats
+type ytdlpInfo struct {
+	Title    string `json:"title"`
+	FormatID string `json:"format_id"` // the picked formats, e.g. "137+140"
+	Formats  []struct {
+		FormatID       string  `json:"format_id"`
+		Ext            string  `json:"ext"`
+		Resolution     string  `json:"resolution"`
+		Height         int     `json:"height"`
+		FPS            float64 `json:"fps"`
+		DynamicRange   string  `json:"dynamic_range"`
+		VCodec         string  `json:"vcodec"`
+		ACodec         string  `json:"acodec"`
+		TBR            float64 `json:"tbr"`
+		Filesize       int64   `json:"filesize"`
+		FilesizeApprox int64   `json:"filesize_approx"`
+		FormatNote     string  `json:"format_note"`
+	} `json:"formats"`
+}
+
+// ListFormats asks yt-dlp which formats the site offers for the request and which of them
+// would be downloaded with the configured video format, the preferences and the tokens of the request.
+func ListFormats(cfg *config.Config, req models.DownloadRequest) (*models.FormatList, error) {
+	cfg = cfg.ForRequest(req)
+
+	prefs := cfg.FormatPreferences.WithOverrides(req.Preferences)
+	format := getYtdlpAudioFormat(prefs.AudioLanguages)
+	var sortArgs []string
+	site := cfg.Sites.Match(req.Url)
+
+	if !req.IsAudioOnly {
+		prefs.AllAudioTracks = prefs.AllAudioTracks && supportsAudioTracks(cfg.VideoFormat)
+		format = getYtdlpFormat(site.PrefersSeparateStreams(), req.Quality, cfg.VideoFormat, prefs)
+		sortArgs = getYtdlpSortArgs(req.Quality, prefs)
+	}
+
+	// -J prints the video information, including every format and the ones picked by -f, without downloading
+	args := []string{
+		"-J",
+		"-f", format,
+		"--user-agent", site.UserAgent,
+		"--no-playlist",
+		"--socket-timeout", "20",
+		"--js-runtimes", dependencies.BinaryPath("deno"),
+	}
+	args = append(args, sortArgs...)
+	if !req.IsAudioOnly {
+		args = append(args, audioTrackArgs(prefs)...)
+	}
+	args = append(args, authArgs(cfg, site)...)
+	args = append(args, proxyArgs(cfg, site, req.Url)...)
+	args = append(args, site.Args()...)
+	args = append(args, req.Url)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(dependencies.BinaryPath("yt-dlp"), args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("yt-dlp failed: %s", maskSecretLine(lastErrorLine(stderr.String(), err)))
+	}
+
+	var info ytdlpInfo
+	if err := json.Unmarshal(stdout.Bytes(), &info); err != nil {
+		return nil, fmt.Errorf("cannot read the yt-dlp output: %v", err)
+	}
+
+	list := &models.FormatList{
+		Url:      req.Url,
+		Title:    info.Title,
+		Selector: format,
+		SortArgs: sortArgs,
+		Selected: strings.Split(info.FormatID, "+"),
+	}
+
+	for _, f := range info.Formats {
+		stream := models.StreamFormat{
+			ID:           f.FormatID,
+			Ext:          f.Ext,
+			Resolution:   f.Resolution,
+			Height:       f.Height,
+			FPS:          f.FPS,
+			DynamicRange: f.DynamicRange,
+			VideoCodec:   f.VCodec,
+			AudioCodec:   f.ACodec,
+			Bitrate:      f.TBR,
+			Size:         f.Filesize,
+			Note:         f.FormatNote,
+		}
+		if stream.Size == 0 && f.FilesizeApprox > 0 {
+			stream.Size = f.FilesizeApprox
+			stream.IsSizeApprox = true
+		}
+		list.Formats = append(list.Formats, stream)
+	}
+
+	return list, nil
+}
+
+// lastErrorLine returns the message of the last ERROR line of the yt-dlp output, or the process error if there is none
+func lastErrorLine(output string, err error) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if errorMatch := errorRegex.FindStringSubmatch(lines[i]); errorMatch != nil {
+			return strings.TrimSpace(errorMatch[1])
+		}
+	}
+	return err.Error()
+}
@@ -0,0 +1,176 @@
+package downloader
+
+import (
+	"downloader/internal/models"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// run directories are named by their start time, the format keeps them sorted by name
+const runDirTimestamp = "20060102-150405"
+
+// createRunLogDir creates the log directory of this run and removes the oldest run directories,
+// keeping at most keepRuns of them (0 keeps all)
+func createRunLogDir(logDir string, keepRuns int) (string, error) {
+	runDir := filepath.Join(logDir, time.Now().Format(runDirTimestamp))
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return "", fmt.Errorf("cannot create log directory: %w", err)
+	}
+
+	if keepRuns > 0 {
+		entries, err := os.ReadDir(logDir)
+		if err != nil {
+			return runDir, nil
+		}
+
+		var runs []string
+		for _, entry := range entries {
+			if entry.IsDir() {
+				runs = append(runs, entry.Name())
+			}
+		}
+		sort.Strings(runs)
+
+		for len(runs) > keepRuns {
+			os.RemoveAll(filepath.Join(logDir, runs[0]))
+			runs = runs[1:]
+		}
+	}
+
+	return runDir, nil
+}
+
+// jobLog writes the full output of a download (all attempts), the command lines and the timing to a file.
+// All methods are safe to call on a nil jobLog, which is used when logging is disabled.
+type jobLog struct {
+	mu      sync.Mutex
+	file    *os.File
+	path    string
+	started time.Time
+}
+
+// openJobLog creates the log file of the request: <run dir>/<line>-<slug>.log
+func (d *Downloader) openJobLog(req models.DownloadRequest) *jobLog {
+	if d.runLogDir == "" {
+		return nil
+	}
+
+	path := filepath.Join(d.runLogDir, fmt.Sprintf("%d-%s.log", req.Line, urlSlug(req.Url)))
+	file, err := os.Create(path)
+	if err != nil {
+		return nil
+	}
+
+	l := &jobLog{file: file, path: path, started: time.Now()}
+	l.printf("Request: %s", req.Raw)
+	l.printf("Line:    %d", req.Line)
+	l.printf("Site:    %s", d.config.Sites.Match(req.Url).Name)
+	if req.Profile != "" {
+		l.printf("Profile: %s", req.Profile)
+	}
+	l.printf("Started: %s", l.started.Format(time.RFC3339))
+
+	return l
+}
+
+// Path returns the path of the log file, or "" if logging is disabled
+func (l *jobLog) Path() string {
+	if l == nil {
+		return ""
+	}
+	return l.path
+}
+
+// startAttempt logs the command line of a new attempt
+func (l *jobLog) startAttempt(attempt int, cmd *exec.Cmd) {
+	l.printf("")
+	l.printf("=== Attempt %d at %s ===", attempt+1, time.Now().Format(time.RFC3339))
+	l.printf("Command: %s", formatCommandLine(cmd.Args))
+	l.printf("")
+}
+
+// endAttempt logs how an attempt ended
+func (l *jobLog) endAttempt(cmd *exec.Cmd, attemptStarted time.Time, result string) {
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+
+	l.printf("")
+	l.printf("Attempt finished after %s with exit code %d: %s", time.Since(attemptStarted).Round(time.Millisecond), exitCode, result)
+}
+
+// line logs a line of the process output, with the secrets hidden
+func (l *jobLog) line(text string, isStderr bool) {
+	text = maskSecretLine(text)
+	if isStderr {
+		l.printf("[stderr] %s", text)
+	} else {
+		l.printf("[stdout] %s", text)
+	}
+}
+
+// close logs the total duration and closes the file
+func (l *jobLog) close(result string) {
+	if l == nil {
+		return
+	}
+
+	l.printf("")
+	l.printf("Finished: %s (took %s): %s", time.Now().Format(time.RFC3339), time.Since(l.started).Round(time.Millisecond), result)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.file.Close()
+}
+
+func (l *jobLog) printf(format string, a ...any) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.file, format+"\n", a...)
+}
+
+// formatCommandLine joins the command arguments, quoting the ones that contain spaces or quotes.
+// The secrets are hidden, see maskSecrets.
+func formatCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range maskSecrets(args) {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'") {
+			quoted[i] = strconv.Quote(arg)
+		} else {
+			quoted[i] = arg
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+var slugRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// urlSlug turns a URL into a short file name friendly string, e.g. "youtube-com-watch-v-abc123"
+func urlSlug(url string) string {
+	slug := strings.ToLower(url)
+	slug = strings.TrimPrefix(slug, "https://")
+	slug = strings.TrimPrefix(slug, "http://")
+	slug = strings.TrimPrefix(slug, "www.")
+	slug = strings.Trim(slugRegex.ReplaceAllString(slug, "-"), "-")
+
+	if len(slug) > 60 {
+		slug = strings.TrimRight(slug[:60], "-")
+	}
+	if slug == "" {
+		slug = "download"
+	}
+	return slug
+}
@@ -0,0 +1,121 @@
+package downloader
+
+import (
+	"downloader/internal/models"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// number of stderr lines kept for the error report
+const stderrTailLines = 10
+
+// Pattern: ERROR: Some error message
+var errorRegex = regexp.MustCompile(`ERROR:\s*(.+)`)
+
+// jobOutput follows the output of a single download attempt.
+// It keeps track of the current phase, the last ERROR line and the last lines written to stderr.
+type jobOutput struct {
+	log *jobLog
+
+	// called when the download makes progress: more data is downloaded or the phase changes
+	onProgress func()
+
+	mu         sync.Mutex
+	phase      string
+	lastError  string
+	stderrTail []string
+}
+
+func newJobOutput(log *jobLog, onProgress func()) *jobOutput {
+	return &jobOutput{log: log, onProgress: onProgress, phase: models.PhasePrepare}
+}
+
+// line records a line of yt-dlp (or ffmpeg) output. The secrets are hidden first,
+// since the error and the stderr tail end up in the error report and summary.json.
+func (o *jobOutput) line(text string, isStderr bool) {
+	text = maskSecretLine(text)
+	o.log.line(text, isStderr)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if errorMatch := errorRegex.FindStringSubmatch(text); errorMatch != nil {
+		o.lastError = errorMatch[1]
+	} else if phase := detectPhase(text); phase != "" && phase != o.phase {
+		o.phase = phase
+		o.onProgress()
+	}
+
+	if isStderr {
+		o.stderrTail = append(o.stderrTail, text)
+		if len(o.stderrTail) > stderrTailLines {
+			o.stderrTail = o.stderrTail[len(o.stderrTail)-stderrTailLines:]
+		}
+	}
+}
+
+func (o *jobOutput) setPhase(phase string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if phase != o.phase {
+		o.phase = phase
+		o.onProgress()
+	}
+}
+
+// progressed tells that more data was downloaded, other output doesn't count as progress
+func (o *jobOutput) progressed() {
+	o.onProgress()
+}
+
+func (o *jobOutput) last() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.lastError
+}
+
+// failure creates the error report entry for the request.
+// If message is empty, the last ERROR line printed by yt-dlp is used.
+func (o *jobOutput) failure(req models.DownloadRequest, message string, exitCode int) *models.DownloadError {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if message == "" {
+		message = o.lastError
+	}
+
+	return &models.DownloadError{
+		Request:     req,
+		Phase:       o.phase,
+		ExitCode:    exitCode,
+		Message:     message,
+		StderrTail:  append([]string(nil), o.stderrTail...),
+		Time:        time.Now(),
+		Explanation: explainError(message, o.stderrTail),
+	}
+}
+
+// detectPhase returns the download phase a yt-dlp output line belongs to, or "" if it doesn't tell
+func detectPhase(line string) string {
+	end := strings.Index(line, "]")
+	if !strings.HasPrefix(line, "[") || end < 2 {
+		return ""
+	}
+
+	tag := line[:end+1]
+
+	switch {
+	case tag == "[debug]":
+		return ""
+	case tag == "[download]" || tag == "[hlsnative]" || tag == "[dashsegments]":
+		return models.PhaseDownload
+	case tag == "[Merger]" || tag == "[VideoRemuxer]" || tag == "[VideoConvertor]" || tag == "[ExtractAudio]" ||
+		tag == "[ffmpeg]" || strings.HasPrefix(tag, "[Fixup"):
+		return models.PhasePostprocess
+	default:
+		// Any other tag is printed by an extractor (e.g. [youtube], [info])
+		return models.PhaseExtract
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+package downloader
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startInProcessGroup makes the command the leader of a new process group,
+// so the ffmpeg processes spawned by yt-dlp can be killed together with it.
+// The group is not in the foreground of the terminal, Ctrl+C reaches it through Downloader.Stop.
+func startInProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessTree kills the command and every process in its group
+func killProcessTree(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+
+	// A negative pid targets the whole process group
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package downloader
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// startInProcessGroup is a no-op on Windows, child processes are found by taskkill instead
+func startInProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessTree kills the command and the ffmpeg processes it spawned
+func killProcessTree(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		cmd.Process.Kill()
+	}
+}
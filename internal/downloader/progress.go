@@ -2,33 +2,34 @@ package downloader
 
 import (
 	"bufio"
+	"downloader/internal/models"
 	"io"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 )
 
-func (d *Downloader) streamClipDownloadProgress(stderrPipe, stdoutPipe io.ReadCloser, clipDurationInSeconds int, progressChan chan int) {
+func (d *Downloader) streamClipDownloadProgress(stderrPipe, stdoutPipe io.ReadCloser, clipDurationInSeconds int, progressChan chan int, output *jobOutput) {
 
 	// Regex to match ffmpeg time output: time=00:00:05.84
 	re := regexp.MustCompile(`time=(\d{2}):(\d{2}):(\d{2})`)
 
-	// Regex to match errors
-	errorRegex := regexp.MustCompile(`ERROR:\s*(.+)`)
-
 	// Read stdout for errors in a separate goroutine
+	var wg sync.WaitGroup
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		scanner := bufio.NewScanner(stdoutPipe)
 		for scanner.Scan() {
-			line := scanner.Text()
-			if errorMatch := errorRegex.FindStringSubmatch(line); errorMatch != nil {
-				d.ErrorCollector.Add(errorMatch[1])
-			}
+			output.line(scanner.Text(), false)
 		}
 	}()
 
 	// We need to read byte by byte because yt-dlp (and ffmpeg) use \r to update progress inline.
 	reader := bufio.NewReader(stderrPipe)
 	var line []byte
+	lastProcessedTime := -1
 
 	for {
 		// Read one byte at a time
@@ -42,21 +43,25 @@ func (d *Downloader) streamClipDownloadProgress(stderrPipe, stdoutPipe io.ReadCl
 			if len(line) > 0 {
 				lineStr := string(line)
 
-				// Check for errors in stderr too
-				if errorMatch := errorRegex.FindStringSubmatch(lineStr); errorMatch != nil {
-					d.ErrorCollector.Add(errorMatch[1])
-					line = nil
-					continue
-				}
-
-				// Parse progress
+				// Parse progress, any other line is recorded for the error report
 				match := re.FindStringSubmatch(lineStr)
-				if len(match) == 4 {
+				if len(match) != 4 {
+					output.line(lineStr, true)
+				} else {
+					output.log.line(lineStr, true)
+					output.setPhase(models.PhaseDownload)
+
 					hours, _ := strconv.Atoi(match[1])
 					minutes, _ := strconv.Atoi(match[2])
 					seconds, _ := strconv.Atoi(match[3])
 
 					processedTime := hours*3600 + minutes*60 + seconds
+
+					// ffmpeg repeats the same time while it waits for data, only a later time is progress
+					if processedTime > lastProcessedTime {
+						lastProcessedTime = processedTime
+						output.progressed()
+					}
 					percentage := (processedTime * 100) / clipDurationInSeconds
 
 					if percentage >= 100 {
@@ -71,9 +76,12 @@ func (d *Downloader) streamClipDownloadProgress(stderrPipe, stdoutPipe io.ReadCl
 			line = append(line, b)
 		}
 	}
+
+	// Wait until stdout is fully read so no error is lost
+	wg.Wait()
 }
 
-func (d *Downloader) streamFullDownloadProgress(stderrPipe, stdoutPipe io.ReadCloser, progressChan chan int) {
+func (d *Downloader) streamFullDownloadProgress(stderrPipe, stdoutPipe io.ReadCloser, progressChan chan int, output *jobOutput) {
 
 	// Pattern 1: Fragment-based progress (frag N/M)
 	// Example: [download]   6.5% of ~  20.20MiB at  889.24KiB/s ETA Unknown (frag 1/38)
@@ -83,38 +91,50 @@ func (d *Downloader) streamFullDownloadProgress(stderrPipe, stdoutPipe io.ReadCl
 	// Example: [download]  21.2% of    9.13MiB at    2.35MiB/s ETA 00:03
 	percentRegex := regexp.MustCompile(`\[download\]\s+(\d+(?:\.\d+)?)%`)
 
-	// Pattern: ERROR: Some error message
-	errorRegex := regexp.MustCompile(`ERROR:\s*(.+)`)
-
 	// Read stderr for errors in a separate goroutine
+	var wg sync.WaitGroup
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		scanner := bufio.NewScanner(stderrPipe)
 		for scanner.Scan() {
-			line := scanner.Text()
-			if errorMatch := errorRegex.FindStringSubmatch(line); errorMatch != nil {
-				d.ErrorCollector.Add(errorMatch[1])
-			}
+			output.line(scanner.Text(), true)
 		}
 	}()
 
 	lastPercentage := 0
 	maxFragmentSeen := 0
 
+	// how far the current file got, for the watchdog. Retries and verbose logs print lines without progress.
+	filePercentage := -1.0
+	fileFragment := 0
+
 	// yt-dlp writes progress to stdout when --newline is used
 	scanner := bufio.NewScanner(stdoutPipe)
 	for scanner.Scan() {
 		line := scanner.Text()
 
-		// Check for errors in stdout too
-		if errorMatches := errorRegex.FindStringSubmatch(line); errorMatches != nil {
-			d.ErrorCollector.Add(errorMatches[1])
+		// Record errors and the current phase from stdout too
+		output.line(line, false)
+		if errorRegex.MatchString(line) {
 			continue
 		}
 
+		// The next file (e.g. the audio stream after the video) starts from 0% again
+		if strings.HasPrefix(line, "[download] Destination:") {
+			filePercentage, fileFragment = -1, 0
+			output.progressed()
+		}
+
 		// Try fragment-based progress first (for fragmented streams)
 		if matches := fragmentRegex.FindStringSubmatch(line); matches != nil {
 			currentFrag, _ := strconv.Atoi(matches[1])
 			totalFrags, _ := strconv.Atoi(matches[2])
+
+			if currentFrag > fileFragment {
+				fileFragment = currentFrag
+				output.progressed()
+			}
 			
 			if currentFrag > maxFragmentSeen {
 				maxFragmentSeen = currentFrag
@@ -130,6 +150,11 @@ func (d *Downloader) streamFullDownloadProgress(stderrPipe, stdoutPipe io.ReadCl
 			// Simple percentage progress (for non-fragmented streams)
 			percentage, err := strconv.ParseFloat(matches[1], 64)
 			if err == nil {
+				if percentage > filePercentage {
+					filePercentage = percentage
+					output.progressed()
+				}
+
 				currentPercentage := int(percentage)
 				if currentPercentage > lastPercentage {
 					lastPercentage = currentPercentage
@@ -138,4 +163,7 @@ func (d *Downloader) streamFullDownloadProgress(stderrPipe, stdoutPipe io.ReadCl
 			}
 		}
 	}
-}
\ No newline at end of file
+
+	// Wait until stderr is fully read so no error is lost
+	wg.Wait()
+}
@@ -0,0 +1,27 @@
+package downloader
+
+import (
+	"downloader/internal/config"
+	"downloader/internal/sites"
+	"downloader/internal/utils"
+)
+
+// proxyArgs returns the yt-dlp arguments for the proxy of the URL. The proxy of the site profile replaces
+// the global one, and the hosts of NO_PROXY are reached directly.
+// Without a proxy setting, yt-dlp uses the proxy environment variables itself.
+func proxyArgs(cfg *config.Config, site sites.Profile, url string) []string {
+	proxy := cfg.Proxy
+	if site.Proxy != "" {
+		proxy = site.Proxy
+	}
+
+	switch {
+	case proxy == "":
+		return nil
+	case proxy == utils.ProxyDirect || utils.BypassesProxy(url, utils.NoProxy()):
+		// an empty proxy makes yt-dlp connect directly, even if the environment has a proxy
+		return []string{"--proxy", ""}
+	default:
+		return []string{"--proxy", proxy}
+	}
+}
@@ -0,0 +1,106 @@
+package downloader
+
+import (
+	"downloader/internal/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// the run summary is written next to the job logs of the run
+const runSummaryFile = "summary.json"
+
+// WriteRunSummary saves the summary of this run in its log directory, with the failures collected by the downloader.
+// It does nothing if logging is disabled.
+func (d *Downloader) WriteRunSummary(summary *models.RunSummary) error {
+	if d.runLogDir == "" {
+		return nil
+	}
+
+	summary.LogDir = d.runLogDir
+
+	// a request is listed once even if it has several errors, every restart is listed
+	written := make(map[int]bool)
+	for _, failure := range d.ErrorCollector.GetAll() {
+		if failure.Recovered {
+			summary.Restarts = append(summary.Restarts, models.RunRestart{
+				Line:    failure.Request.Line,
+				Url:     failure.Request.Url,
+				Attempt: failure.Attempt,
+				Phase:   failure.Phase,
+				Message: failure.Message,
+				Log:     failure.LogFile,
+			})
+			continue
+		}
+		if written[failure.Request.Line] {
+			continue
+		}
+		written[failure.Request.Line] = true
+
+		runFailure := models.RunFailure{
+			Line:    failure.Request.Line,
+			Url:     failure.Request.Url,
+			Phase:   failure.Phase,
+			Message: failure.Message,
+		}
+		if failure.Explanation != nil {
+			runFailure.Category = failure.Explanation.Category
+		}
+		summary.Failures = append(summary.Failures, runFailure)
+	}
+	sort.Slice(summary.Failures, func(i, j int) bool {
+		return summary.Failures[i].Line < summary.Failures[j].Line
+	})
+	sort.SliceStable(summary.Restarts, func(i, j int) bool {
+		return summary.Restarts[i].Line < summary.Restarts[j].Line
+	})
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(d.runLogDir, runSummaryFile), data, 0644); err != nil {
+		return fmt.Errorf("couldn't write the run summary: %w", err)
+	}
+	return nil
+}
+
+// ReadRunSummaries reads the summaries of the runs in logDir, the most recent first.
+// Runs without a summary (e.g. interrupted ones) are skipped.
+func ReadRunSummaries(logDir string) ([]*models.RunSummary, error) {
+	entries, err := os.ReadDir(logDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var summaries []*models.RunSummary
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(logDir, entry.Name(), runSummaryFile))
+		if err != nil {
+			continue
+		}
+
+		var summary models.RunSummary
+		if err := json.Unmarshal(data, &summary); err != nil {
+			return nil, fmt.Errorf("invalid run summary in %s: %w", entry.Name(), err)
+		}
+		summaries = append(summaries, &summary)
+	}
+
+	// run directories are named by their start time
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Started.After(summaries[j].Started)
+	})
+
+	return summaries, nil
+}
@@ -0,0 +1,38 @@
+package downloader
+
+// acquireSlot waits until the site of the URL has a free download slot, then until there is a free slot
+// among all downloads, and returns the function releasing both.
+// The site slot is taken first so downloads waiting for a busy site don't hold a global slot.
+func (d *Downloader) acquireSlot(url string) (release func()) {
+	releaseSite := d.acquireSiteSlot(url)
+
+	if d.slots == nil {
+		return releaseSite
+	}
+
+	d.slots <- struct{}{}
+	return func() {
+		<-d.slots
+		releaseSite()
+	}
+}
+
+// acquireSiteSlot waits until the site of the URL has a free download slot and returns the function releasing it.
+// Sites without a concurrency limit always have a free slot.
+func (d *Downloader) acquireSiteSlot(url string) (release func()) {
+	site := d.config.Sites.Match(url)
+	if site.Concurrency <= 0 {
+		return func() {}
+	}
+
+	d.slotsMu.Lock()
+	slots, ok := d.siteSlots[site.Name]
+	if !ok {
+		slots = make(chan struct{}, site.Concurrency)
+		d.siteSlots[site.Name] = slots
+	}
+	d.slotsMu.Unlock()
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
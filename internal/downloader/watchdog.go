@@ -0,0 +1,96 @@
+package downloader
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// watchdog kills a download process that stops making progress or runs longer than allowed.
+// It is fed by the progress parsers through touch: only more downloaded data or a new phase counts as progress,
+// so a process stuck in a retry loop or printing verbose logs is still stopped.
+type watchdog struct {
+	stallTimeout time.Duration // 0 disables the stall check
+	jobTimeout   time.Duration // 0 disables the hard timeout
+
+	activity chan struct{}
+	done     chan struct{}
+
+	mu     sync.Mutex
+	reason string
+}
+
+func newWatchdog(stallTimeout, jobTimeout time.Duration) *watchdog {
+	return &watchdog{
+		stallTimeout: stallTimeout,
+		jobTimeout:   jobTimeout,
+		activity:     make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+}
+
+// watch monitors the command until stop is called, killing it if it stalls or times out
+func (w *watchdog) watch(cmd *exec.Cmd) {
+
+	var stallChan, jobChan <-chan time.Time
+
+	if w.stallTimeout > 0 {
+		stallTimer := time.NewTimer(w.stallTimeout)
+		defer stallTimer.Stop()
+		stallChan = stallTimer.C
+
+		go func() {
+			for {
+				select {
+				case <-w.activity:
+					stallTimer.Reset(w.stallTimeout)
+				case <-w.done:
+					return
+				}
+			}
+		}()
+	}
+
+	if w.jobTimeout > 0 {
+		jobTimer := time.NewTimer(w.jobTimeout)
+		defer jobTimer.Stop()
+		jobChan = jobTimer.C
+	}
+
+	select {
+	case <-stallChan:
+		w.kill(cmd, fmt.Sprintf("stalled (no progress for %s)", w.stallTimeout))
+	case <-jobChan:
+		w.kill(cmd, fmt.Sprintf("timed out (running for more than %s)", w.jobTimeout))
+	case <-w.done:
+	}
+}
+
+// stop ends the monitoring, it must be called once the process has exited
+func (w *watchdog) stop() {
+	close(w.done)
+}
+
+// firedReason returns why the process was killed, or "" if it wasn't
+func (w *watchdog) firedReason() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.reason
+}
+
+func (w *watchdog) kill(cmd *exec.Cmd, reason string) {
+	w.mu.Lock()
+	w.reason = reason
+	w.mu.Unlock()
+
+	killProcessTree(cmd)
+}
+
+// touch tells the watchdog the download made progress, it restarts the stall timer
+func (w *watchdog) touch() {
+	select {
+	case w.activity <- struct{}{}:
+	default:
+	}
+}
@@ -1,17 +1,272 @@
 package models
 
-type VideoFormat int
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
 
-const (
-	FormatAny       VideoFormat = iota // Any format
-	FormatPreferMP4                    // Prefer MP4 when available
-	FormatForceMP4                     // Force MP4 (convert if necessary)
+// VideoFormat selects the container of video downloads
+type VideoFormat struct {
+	Container string // "mp4", "mkv", "webm", "mov" or "" for any
+	Force     bool   // convert the video when the site doesn't offer the container
+}
+
+// The supported video containers
+var VideoContainers = []string{"mp4", "mkv", "webm", "mov"}
+
+var (
+	FormatAny       = VideoFormat{}                              // Any format
+	FormatPreferMP4 = VideoFormat{Container: "mp4"}              // Prefer MP4 when available
+	FormatForceMP4  = VideoFormat{Container: "mp4", Force: true} // Force MP4 (convert if necessary)
 )
 
+// String returns the name of the video format: "any", "prefer-<container>" or "force-<container>"
+func (f VideoFormat) String() string {
+	switch {
+	case f.Container == "":
+		return "any"
+	case f.Force:
+		return "force-" + f.Container
+	default:
+		return "prefer-" + f.Container
+	}
+}
+
+// FormatPreferences narrows down which video stream is selected.
+// The zero value has no preferences.
+type FormatPreferences struct {
+	Codecs       []string // preferred video codecs, best first: "h264", "h265", "vp9" or "av1"
+	MaxFPS       int      // highest frame rate, 0 means no limit
+	DynamicRange string   // "sdr", "hdr" or "" for any
+	MaxBitrate   int      // highest video bitrate in kbps, 0 means no limit
+
+	AudioLanguages []string // preferred audio languages, best first, e.g. "ar", "en" (also used for audio-only downloads)
+	AllAudioTracks bool     // keep every audio track instead of the best one, if the container supports it
+}
+
+// HasVideoPreferences returns true if a preference that only applies to videos is set
+func (p FormatPreferences) HasVideoPreferences() bool {
+	return len(p.Codecs) > 0 || p.MaxFPS > 0 || p.DynamicRange != "" || p.MaxBitrate > 0 || p.AllAudioTracks
+}
+
+// WithOverrides returns the preferences with every field that is set in overrides replaced
+func (p FormatPreferences) WithOverrides(overrides FormatPreferences) FormatPreferences {
+	if len(overrides.Codecs) > 0 {
+		p.Codecs = overrides.Codecs
+	}
+	if overrides.MaxFPS > 0 {
+		p.MaxFPS = overrides.MaxFPS
+	}
+	if overrides.DynamicRange != "" {
+		p.DynamicRange = overrides.DynamicRange
+	}
+	if overrides.MaxBitrate > 0 {
+		p.MaxBitrate = overrides.MaxBitrate
+	}
+	if len(overrides.AudioLanguages) > 0 {
+		p.AudioLanguages = overrides.AudioLanguages
+	}
+	if overrides.AllAudioTracks {
+		p.AllAudioTracks = true
+	}
+	return p
+}
+
+// AudioOutput selects how audio-only downloads are converted.
+// The zero value keeps the audio as served by the site.
+type AudioOutput struct {
+	Format  string // "mp3", "m4a", "opus", "flac", "wav" or "" to keep the original format
+	Quality string // a bitrate like "192K" or a VBR quality from "0" (best) to "10"; "" means the best quality
+}
+
+// WithOverrides returns the audio output with every field that is set in overrides replaced
+func (a AudioOutput) WithOverrides(overrides AudioOutput) AudioOutput {
+	if overrides.Format != "" {
+		a.Format = overrides.Format
+		a.Quality = overrides.Quality
+	} else if overrides.Quality != "" {
+		a.Quality = overrides.Quality
+	}
+	return a
+}
+
+// IsLossless returns true if the format doesn't use a bitrate or quality setting
+func (a AudioOutput) IsLossless() bool {
+	return a.Format == "flac" || a.Format == "wav"
+}
+
+// Quality limits the resolution and size of the video and selects the best or lowest quality.
+// The zero value selects the best available quality.
+type Quality struct {
+	MaxHeight int    // highest resolution height, e.g. 720 for "720p" or 1080 for "hd"; 0 means no limit
+	MinHeight int    // lowest resolution height, e.g. 720 for ">=720p"; 0 means no limit
+	MaxSize   int64  // file size limit in bytes, e.g. 200000000 for "<200MB"; 0 means no limit
+	Order     string // "worst" or "smallest" to get the lowest quality or smallest file, "" for the best quality
+}
+
+// IsSet returns true if any quality constraint is set
+func (q Quality) IsSet() bool {
+	return q != Quality{}
+}
+
+// String describes the quality for labels, e.g. "720p", ">=720p <200MB" or "smallest"
+func (q Quality) String() string {
+	var parts []string
+	if q.Order != "" {
+		parts = append(parts, q.Order)
+	}
+	if q.MinHeight > 0 {
+		parts = append(parts, fmt.Sprintf(">=%dp", q.MinHeight))
+	}
+	if q.MaxHeight > 0 {
+		parts = append(parts, fmt.Sprintf("%dp", q.MaxHeight))
+	}
+	if q.MaxSize > 0 {
+		parts = append(parts, "<"+FormatSize(q.MaxSize))
+	}
+	if len(parts) == 0 {
+		return "best quality"
+	}
+	return strings.Join(parts, " ")
+}
+
+// FormatSize formats a size in bytes with the largest fitting unit and one decimal, e.g. "200MB" or "1.5GB"
+func FormatSize(bytes int64) string {
+	value, unit := float64(bytes)/1e3, "KB"
+	switch {
+	case bytes >= 1e9:
+		value, unit = float64(bytes)/1e9, "GB"
+	case bytes >= 1e6:
+		value, unit = float64(bytes)/1e6, "MB"
+	}
+	return strconv.FormatFloat(math.Round(value*10)/10, 'f', -1, 64) + unit
+}
+
 type DownloadRequest struct {
+	Line          int    // line number in the input file (1-based)
+	Raw           string // the line as written in the input file
 	Url           string
-	Quality       string
+	Quality       Quality
 	IsClip        bool
 	ClipTimeRange string // should be in the format HH:MM:SS-HH:MM:SS
 	IsAudioOnly   bool
+	Profile       string // the named profile of the line ("profile:<name>"), or the one given with -profile
+
+	// per-line format preferences, they override the global ones
+	Preferences FormatPreferences
+
+	// per-line audio conversion (e.g. "audio:mp3@192k"), it overrides the global one
+	AudioOutput AudioOutput
+
+	// the tokens of the line that were not understood, they are ignored
+	UnknownTokens []string
+}
+
+// Download phases, used to report where a download failed
+const (
+	PhasePrepare     = "prepare"     // building the command (e.g. parsing the clip range)
+	PhaseStart       = "start"       // starting the yt-dlp process
+	PhaseExtract     = "extract"     // extracting video information from the site
+	PhaseDownload    = "download"    // downloading the streams
+	PhasePostprocess = "postprocess" // merging, remuxing, re-encoding or extracting audio
+)
+
+// DownloadError describes a single failure (or recovered stall) of a download request
+type DownloadError struct {
+	Request    DownloadRequest
+	Phase      string    // the phase the download was in
+	ExitCode   int       // exit code of the yt-dlp process, -1 if it didn't exit on its own
+	Message    string    // the last ERROR line printed by yt-dlp, or a description of what went wrong
+	StderrTail []string  // the last lines written to stderr
+	Time       time.Time // when the failure happened
+	LogFile    string    // the log file with the full output of the download, if any
+	Recovered  bool      // true if the download was restarted after this error (e.g. a stall)
+	Attempt    int       // the attempt that failed, from 1
+
+	// the explanation of the error, nil if it doesn't match a known error
+	Explanation *ErrorExplanation
+}
+
+func (e *DownloadError) Error() string {
+	return e.Message
+}
+
+// ErrorExplanation is a plain-language explanation of a known yt-dlp error
+type ErrorExplanation struct {
+	Category    string // short name of the problem (e.g. "Rate limited")
+	Explanation string // what the error means, for non-technical users
+	Suggestion  string // what the user can do about it
+}
+
+// StreamFormat is one of the formats a site offers for a video, as listed by yt-dlp
+type StreamFormat struct {
+	ID           string  `json:"id"`
+	Ext          string  `json:"ext"`
+	Resolution   string  `json:"resolution"` // e.g. "1920x1080" or "audio only"
+	Height       int     `json:"height,omitempty"`
+	FPS          float64 `json:"fps,omitempty"`
+	DynamicRange string  `json:"dynamic_range,omitempty"` // "SDR", "HDR10", ... or "" for audio
+	VideoCodec   string  `json:"vcodec"`                  // "none" for audio only formats
+	AudioCodec   string  `json:"acodec"`                  // "none" for video only formats
+	Bitrate      float64 `json:"bitrate,omitempty"`       // total bitrate in kbps
+	Size         int64   `json:"size,omitempty"`          // in bytes, 0 if unknown
+	IsSizeApprox bool    `json:"size_approx,omitempty"`   // the size is estimated from the bitrate and duration
+	Note         string  `json:"note,omitempty"`
+}
+
+// FormatList describes the formats available for a URL and which of them would be downloaded
+type FormatList struct {
+	Url      string         `json:"url"`
+	Title    string         `json:"title"`
+	Selector string         `json:"selector"`            // the yt-dlp format selector built from the settings and tokens
+	SortArgs []string       `json:"sort_args,omitempty"` // the -S arguments passed with the selector
+	Selected []string       `json:"selected"`            // IDs of the picked formats, e.g. ["137", "140"] for "137+140"
+	Formats  []StreamFormat `json:"formats"`
+}
+
+// IsSelected returns true if the format would be downloaded
+func (l *FormatList) IsSelected(id string) bool {
+	for _, selected := range l.Selected {
+		if selected == id {
+			return true
+		}
+	}
+	return false
+}
+
+// RunSummary describes a finished download run, it is saved in the log directory of the run
+type RunSummary struct {
+	Command   string       `json:"command"`    // "download" or "retry"
+	InputFile string       `json:"input_file"` // the file the requests were read from
+	Started   time.Time    `json:"started"`
+	Finished  time.Time    `json:"finished"`
+	Total     int          `json:"total"`
+	Failed    int          `json:"failed"`
+	ExitCode  int          `json:"exit_code"`
+	RetryFile string       `json:"retry_file,omitempty"` // the file the failed requests were written to
+	LogDir    string       `json:"log_dir"`
+	Failures  []RunFailure `json:"failures,omitempty"`
+	Restarts  []RunRestart `json:"restarts,omitempty"` // the downloads restarted after a stall, failed or not
+}
+
+// RunRestart is a restart of a stalled download in a run
+type RunRestart struct {
+	Line    int    `json:"line"`
+	Url     string `json:"url"`
+	Attempt int    `json:"attempt"` // the attempt that stalled, from 1
+	Phase   string `json:"phase"`
+	Message string `json:"message"`
+	Log     string `json:"log,omitempty"`
+}
+
+// RunFailure is a request that failed in a run
+type RunFailure struct {
+	Line     int    `json:"line"`
+	Url      string `json:"url"`
+	Phase    string `json:"phase"`
+	Message  string `json:"message"`
+	Category string `json:"category,omitempty"` // the category of the explanation, if the error is known
 }
@@ -0,0 +1,243 @@
+package sites
+
+import (
+	"downloader/internal/utils"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Format strategies
+const (
+	// prefer separate video and audio streams, the site serves its best qualities that way (e.g. YouTube)
+	StrategySeparate = "separate"
+
+	// prefer a single file holding video and audio, fall back to separate streams
+	StrategyMerged = "merged"
+)
+
+// Profile holds the download settings of a site
+type Profile struct {
+	// the name shown in logs and used to replace a built-in profile
+	Name string `json:"name"`
+
+	// the hostnames of the site, a hostname also matches its subdomains ("youtube.com" matches "m.youtube.com")
+	Hosts []string `json:"hosts"`
+
+	// "separate" or "merged", see the Strategy constants
+	FormatStrategy string `json:"format_strategy,omitempty"`
+
+	// extra HTTP headers sent with every request, e.g. {"Referer": "https://example.com"}
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// the User-Agent header, "random" lets yt-dlp choose one
+	UserAgent string `json:"user_agent,omitempty"`
+
+	// how many downloads from the site run at the same time, 0 means no limit
+	Concurrency int `json:"concurrency,omitempty"`
+
+	// how many fragments of a download are fetched at the same time
+	FragmentConcurrency int `json:"fragment_concurrency,omitempty"`
+
+	// arguments added to the yt-dlp command line, e.g. ["--extractor-args", "youtube:player_client=web"]
+	ExtraArgs []string `json:"extra_args,omitempty"`
+
+	// the Netscape cookie file used for the site instead of the global one, a bare file name
+	// is a file of the cookies folder of the app data directory
+	Cookies string `json:"cookies,omitempty"`
+
+	// the browser the cookies of the site are read from, e.g. "firefox" or "chrome:Profile 1"
+	CookiesFromBrowser string `json:"cookies_from_browser,omitempty"`
+
+	// the proxy used for the site instead of the global one, e.g. "socks5://127.0.0.1:1080",
+	// "direct" connects without a proxy
+	Proxy string `json:"proxy,omitempty"`
+}
+
+// Default is used for the sites without a profile and fills the settings a profile leaves empty
+var Default = Profile{
+	Name:                "default",
+	FormatStrategy:      StrategyMerged,
+	UserAgent:           "random",
+	FragmentConcurrency: 3,
+}
+
+// builtIn are the profiles of the big sites
+var builtIn = []Profile{
+	{
+		Name:           "youtube",
+		Hosts:          []string{"youtube.com", "youtu.be", "youtube-nocookie.com"},
+		FormatStrategy: StrategySeparate,
+	},
+	{
+		Name:           "vimeo",
+		Hosts:          []string{"vimeo.com"},
+		FormatStrategy: StrategySeparate,
+	},
+	{
+		Name:           "reddit",
+		Hosts:          []string{"reddit.com", "redd.it"},
+		FormatStrategy: StrategySeparate,
+	},
+	{
+		Name:        "twitter",
+		Hosts:       []string{"x.com", "twitter.com"},
+		Concurrency: 3,
+	},
+	{
+		Name:        "instagram",
+		Hosts:       []string{"instagram.com"},
+		Concurrency: 2,
+	},
+	{
+		Name:        "tiktok",
+		Hosts:       []string{"tiktok.com"},
+		Concurrency: 2,
+	},
+	{
+		Name:  "facebook",
+		Hosts: []string{"facebook.com", "fb.watch"},
+	},
+	{
+		Name:  "twitch",
+		Hosts: []string{"twitch.tv"},
+	},
+}
+
+// Registry finds the profile of a URL among the user and built-in profiles
+type Registry struct {
+	profiles []Profile
+}
+
+// NewRegistry creates a registry with the user profiles and the built-in ones.
+// A user profile replaces the built-in profile with the same name, and is matched before the others.
+func NewRegistry(userProfiles []Profile) (*Registry, error) {
+	replaced := make(map[string]bool)
+	var profiles []Profile
+
+	for i, p := range userProfiles {
+		if err := validate(p); err != nil {
+			return nil, fmt.Errorf("site profile %d (%s): %v", i+1, p.Name, err)
+		}
+		replaced[p.Name] = true
+		profiles = append(profiles, p)
+	}
+
+	for _, p := range builtIn {
+		if !replaced[p.Name] {
+			profiles = append(profiles, p)
+		}
+	}
+
+	return &Registry{profiles: profiles}, nil
+}
+
+func validate(p Profile) error {
+	if p.Name == "" {
+		return fmt.Errorf("name is missing")
+	}
+	if len(p.Hosts) == 0 {
+		return fmt.Errorf("hosts are missing")
+	}
+	if p.FormatStrategy != "" && p.FormatStrategy != StrategySeparate && p.FormatStrategy != StrategyMerged {
+		return fmt.Errorf("unknown format_strategy %q (expected %s or %s)", p.FormatStrategy, StrategySeparate, StrategyMerged)
+	}
+	if p.Concurrency < 0 || p.FragmentConcurrency < 0 {
+		return fmt.Errorf("concurrency and fragment_concurrency can't be negative")
+	}
+	if p.Cookies != "" && p.CookiesFromBrowser != "" {
+		return fmt.Errorf("set cookies or cookies_from_browser, not both")
+	}
+	if p.CookiesFromBrowser != "" {
+		if err := ValidateBrowser(p.CookiesFromBrowser); err != nil {
+			return fmt.Errorf("invalid cookies_from_browser: %v", err)
+		}
+	}
+	if p.Proxy != "" {
+		if err := utils.ValidateProxy(p.Proxy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the browsers yt-dlp can read cookies from
+var browsers = []string{"brave", "chrome", "chromium", "edge", "firefox", "opera", "safari", "vivaldi", "whale"}
+
+// ValidateBrowser checks a yt-dlp --cookies-from-browser value: BROWSER[+KEYRING][:PROFILE][::CONTAINER]
+func ValidateBrowser(spec string) error {
+	browser, _, _ := strings.Cut(spec, ":")
+	browser, _, _ = strings.Cut(browser, "+")
+	if !slices.Contains(browsers, strings.ToLower(browser)) {
+		return fmt.Errorf("unknown browser %q (expected one of %s)", browser, strings.Join(browsers, ", "))
+	}
+	return nil
+}
+
+// Match returns the profile of the URL, with the empty settings filled from the default profile.
+// URLs of unknown sites (or that can't be parsed) get the default profile.
+func (r *Registry) Match(rawURL string) Profile {
+	host := hostname(rawURL)
+
+	for _, p := range r.profiles {
+		for _, h := range p.Hosts {
+			h = strings.ToLower(h)
+			if host == h || strings.HasSuffix(host, "."+h) {
+				return withDefaults(p)
+			}
+		}
+	}
+
+	return Default
+}
+
+// hostname returns the lowercase hostname of the URL, the scheme is optional ("youtu.be/abc" works too)
+func hostname(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func withDefaults(p Profile) Profile {
+	if p.FormatStrategy == "" {
+		p.FormatStrategy = Default.FormatStrategy
+	}
+	if p.UserAgent == "" {
+		p.UserAgent = Default.UserAgent
+	}
+	if p.FragmentConcurrency == 0 {
+		p.FragmentConcurrency = Default.FragmentConcurrency
+	}
+	return p
+}
+
+// PrefersSeparateStreams returns true if separate video and audio streams are tried before merged files
+func (p Profile) PrefersSeparateStreams() bool {
+	return p.FormatStrategy == StrategySeparate
+}
+
+// Args returns the yt-dlp arguments for the headers and extra arguments of the profile
+func (p Profile) Args() []string {
+	var args []string
+
+	// sorted so the command line is the same on every run
+	names := make([]string, 0, len(p.Headers))
+	for name := range p.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		args = append(args, "--add-header", name+":"+p.Headers[name])
+	}
+
+	return append(args, p.ExtraArgs...)
+}
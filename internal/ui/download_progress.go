@@ -1,14 +1,52 @@
 package ui
 
 import (
+	"downloader/internal/models"
 	"fmt"
+	"sync"
 
 	"github.com/fatih/color"
 	"github.com/gosuri/uiprogress"
 	"github.com/gosuri/uiprogress/util/strutil"
 )
 
-func ShowDownloadProgress(message string) *uiprogress.Bar {
+// DownloadProgress reports the state of a single download in the current output mode
+type DownloadProgress interface {
+	// Start marks the download as started (it was queued until now)
+	Start()
+
+	// Set updates the download percentage
+	Set(percentage int)
+
+	// Finish marks the download as successfully completed
+	Finish()
+
+	// Restart reports that the download stalled and was restarted
+	Restart(err *models.DownloadError)
+
+	// Fail marks the download as failed
+	Fail(err *models.DownloadError)
+}
+
+// ShowDownloadProgress registers a download and returns a handle to report its progress.
+// The id identifies the download in plain and JSON output, the label is shown above the progress bar in interactive mode.
+func ShowDownloadProgress(id int, req models.DownloadRequest, label string) DownloadProgress {
+	switch outputMode {
+	case ModeInteractive:
+		return newBarProgress(label)
+	default:
+		p := &lineProgress{id: id, req: req}
+		p.emit(Event{Event: "queued"})
+		return p
+	}
+}
+
+// barProgress draws a progress bar using uiprogress
+type barProgress struct {
+	bar *uiprogress.Bar
+}
+
+func newBarProgress(message string) *barProgress {
 	// Define colors
 	green := color.New(color.FgGreen).SprintFunc()
 	cyan := color.New(color.FgCyan).SprintFunc()
@@ -32,6 +70,91 @@ func ShowDownloadProgress(message string) *uiprogress.Bar {
 		return cyan(percentage)
 	})
 
-	// Return the bar so caller can update it
-	return bar
+	return &barProgress{bar: bar}
+}
+
+func (p *barProgress) Start() {}
+
+func (p *barProgress) Set(percentage int) {
+	p.bar.Set(percentage)
+}
+
+func (p *barProgress) Finish() {}
+
+// Restarts continue from the downloaded data, so the bar keeps its progress
+func (p *barProgress) Restart(err *models.DownloadError) {}
+
+// Failures are listed in the summary after all downloads finish
+func (p *barProgress) Fail(err *models.DownloadError) {}
+
+// lineProgress prints one line (or JSON event) per state change
+type lineProgress struct {
+	id   int
+	req  models.DownloadRequest
+	mu   sync.Mutex
+	last int
+}
+
+func (p *lineProgress) Start() {
+	p.emit(Event{Event: "started"})
+}
+
+func (p *lineProgress) Set(percentage int) {
+	p.mu.Lock()
+	changed := percentage != p.last
+	p.last = percentage
+	p.mu.Unlock()
+
+	// Only JSON consumers get every progress update, plain logs would be flooded
+	if changed && outputMode == ModeJSON {
+		p.emit(Event{Event: "progress", Percent: &percentage})
+	}
+}
+
+func (p *lineProgress) Finish() {
+	p.emit(Event{Event: "finished"})
+}
+
+func (p *lineProgress) Restart(err *models.DownloadError) {
+	attempt := err.Attempt
+	event := Event{Event: "restarted", Reason: err.Message, Phase: err.Phase, Attempt: &attempt, Log: err.LogFile}
+
+	if err.Explanation != nil {
+		event.Category = err.Explanation.Category
+	}
+
+	p.emit(event)
+}
+
+func (p *lineProgress) Fail(err *models.DownloadError) {
+	exitCode := err.ExitCode
+	event := Event{Event: "failed", Reason: err.Message, Phase: err.Phase, ExitCode: &exitCode, Log: err.LogFile}
+
+	if err.Explanation != nil {
+		event.Category = err.Explanation.Category
+		event.Suggestion = err.Explanation.Suggestion
+	}
+
+	p.emit(event)
+}
+
+func (p *lineProgress) emit(event Event) {
+	event.ID = p.id
+	event.Line = p.req.Line
+	event.URL = p.req.Url
+
+	switch outputMode {
+	case ModeJSON:
+		EmitEvent(event)
+	case ModePlain:
+		if event.Reason != "" {
+			fmt.Printf("[%d] %s: %s (line %d, %s: %s)\n", p.id, event.Event, p.req.Url, p.req.Line, event.Phase, event.Reason)
+		} else {
+			fmt.Printf("[%d] %s: %s\n", p.id, event.Event, p.req.Url)
+		}
+	case ModeQuiet:
+		if event.Event == "failed" {
+			Errorln(fmt.Sprintf("[%d] failed: %s (line %d, %s: %s)", p.id, p.req.Url, p.req.Line, event.Phase, event.Reason))
+		}
+	}
 }
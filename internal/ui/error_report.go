@@ -0,0 +1,83 @@
+package ui
+
+import (
+	"downloader/internal/models"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+)
+
+// PrintErrorReport prints a table with one row per failed (or restarted) download,
+// followed by the last stderr lines of each failure
+func PrintErrorReport(errors []*models.DownloadError) {
+	// show the errors in the order of the input file
+	errors = append([]*models.DownloadError(nil), errors...)
+	sort.SliceStable(errors, func(i, j int) bool {
+		return errors[i].Request.Line < errors[j].Request.Line
+	})
+
+	var table strings.Builder
+
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tSTATUS\tPHASE\tEXIT\tTIME\tURL\tPROBLEM\tERROR")
+
+	for _, err := range errors {
+		status := "failed"
+		if err.Recovered {
+			status = "restarted"
+		}
+
+		exitCode := "-"
+		if err.ExitCode >= 0 {
+			exitCode = fmt.Sprint(err.ExitCode)
+		}
+
+		category := "Unknown"
+		if err.Explanation != nil {
+			category = err.Explanation.Category
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			err.Request.Line,
+			status,
+			err.Phase,
+			exitCode,
+			err.Time.Format("15:04:05"),
+			err.Request.Url,
+			category,
+			err.Message,
+		)
+	}
+	w.Flush()
+
+	Errorln(color.RedString("Errors:"))
+	Errorln()
+	Errorln(strings.TrimRight(table.String(), "\n"))
+
+	// The explanation and stderr tail help with failures, especially those that didn't print an ERROR line
+	for _, err := range errors {
+		if err.Recovered {
+			continue
+		}
+
+		Errorln()
+		Errorln(fmt.Sprintf("Line %d (%s):", err.Request.Line, err.Request.Raw))
+		Errorln("  Error: " + err.Message)
+		if err.Explanation != nil {
+			Errorln("  What happened: " + err.Explanation.Explanation)
+			Errorln("  What to do: " + color.CyanString(err.Explanation.Suggestion))
+		}
+		if len(err.StderrTail) > 0 {
+			Errorln("  Last stderr output:")
+			for _, line := range err.StderrTail {
+				Errorln("    " + line)
+			}
+		}
+		if err.LogFile != "" {
+			Errorln("  Full log: " + err.LogFile)
+		}
+	}
+}
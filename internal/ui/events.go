@@ -0,0 +1,50 @@
+package ui
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event is a single newline-delimited JSON event written to stdout in JSON mode
+type Event struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	ID       int       `json:"id,omitempty"`
+	Line     int       `json:"line,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	Percent  *int      `json:"percent,omitempty"`
+	Status   string    `json:"status,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Phase    string    `json:"phase,omitempty"`
+	ExitCode *int      `json:"exit_code,omitempty"`
+	Log      string    `json:"log,omitempty"`
+	Attempt  *int      `json:"attempt,omitempty"`
+
+	// plain-language explanation of a failure, if it is a known error
+	Category   string `json:"category,omitempty"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+var (
+	eventEncoder = json.NewEncoder(os.Stdout)
+	eventMu      sync.Mutex
+)
+
+// EmitEvent writes the event to stdout as a single JSON line.
+// It does nothing unless the output mode is JSON.
+func EmitEvent(event Event) {
+	if outputMode != ModeJSON {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	eventEncoder.Encode(event)
+}
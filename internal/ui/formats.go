@@ -0,0 +1,85 @@
+package ui
+
+import (
+	"downloader/internal/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+)
+
+// PrintFormats prints the formats available for a URL as a table, marking the ones that would be downloaded.
+// In JSON mode the list is printed as a single JSON object.
+func PrintFormats(list *models.FormatList) {
+	if outputMode == ModeJSON {
+		json.NewEncoder(os.Stdout).Encode(list)
+		return
+	}
+
+	var table strings.Builder
+
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, " \tID\tEXT\tRESOLUTION\tFPS\tRANGE\tVCODEC\tACODEC\tBITRATE\tSIZE\tNOTE")
+
+	for _, f := range list.Formats {
+		marker := ""
+		if list.IsSelected(f.ID) {
+			marker = "*"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			marker,
+			f.ID,
+			f.Ext,
+			f.Resolution,
+			formatNumber(f.FPS, ""),
+			orDash(f.DynamicRange),
+			orDash(f.VideoCodec),
+			orDash(f.AudioCodec),
+			formatNumber(f.Bitrate, "k"),
+			formatStreamSize(f),
+			f.Note,
+		)
+	}
+	w.Flush()
+
+	fmt.Println(list.Title)
+	fmt.Println(list.Url)
+	fmt.Println()
+	fmt.Println(strings.TrimRight(table.String(), "\n"))
+	fmt.Println()
+	fmt.Println(color.CyanString("* = downloaded with the current settings: %s", strings.Join(list.Selected, "+")))
+	fmt.Println("Format selector:", list.Selector)
+	if len(list.SortArgs) > 0 {
+		fmt.Println("Sort order:", strings.Join(list.SortArgs[1:], " "))
+	}
+}
+
+// formatNumber formats a number without decimals followed by the unit, or "-" if it is unknown
+func formatNumber(value float64, unit string) string {
+	if value == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%s", value, unit)
+}
+
+// formatStreamSize formats the size of a stream, prefixed with "~" if it is estimated
+func formatStreamSize(f models.StreamFormat) string {
+	if f.Size == 0 {
+		return "-"
+	}
+	if f.IsSizeApprox {
+		return "~" + models.FormatSize(f.Size)
+	}
+	return models.FormatSize(f.Size)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"fmt"
 	"io"
 	"sync"
 
@@ -29,8 +30,13 @@ type ProgressLine struct {
 	writer  io.Writer
 }
 
-// ShowLoading shows a loading spinner with custom message and returns a handle to complete it
+// ShowLoading shows a loading spinner with custom message and returns a handle to complete it.
+// Outside interactive mode no spinner is drawn, only the final state is reported.
 func ShowLoading(message string) *ProgressLine {
+	if !IsInteractive() {
+		return &ProgressLine{}
+	}
+
 	mu.Lock()
 	if multiPrinter == nil {
 		multi := pterm.DefaultMultiPrinter
@@ -56,12 +62,42 @@ func ShowLoading(message string) *ProgressLine {
 
 // Complete changes the line to show success with custom message
 func (pl *ProgressLine) Complete(message string) {
-	pl.spinner.Stop()
-	pterm.Fprintln(pl.writer, pterm.Green(message+" [DONE]"))
+	switch outputMode {
+	case ModeInteractive:
+		pl.spinner.Stop()
+		pterm.Fprintln(pl.writer, pterm.Green(message+" [DONE]"))
+	case ModePlain:
+		fmt.Println(message)
+	case ModeJSON:
+		EmitEvent(Event{Event: "step", Status: "done", Message: message})
+	}
 }
 
 // Fail changes the line to show failure with custom message
 func (pl *ProgressLine) Fail(message string) {
-	pl.spinner.Stop()
-	pterm.Fprintln(pl.writer, pterm.Red(message+" X"))
+	switch outputMode {
+	case ModeInteractive:
+		pl.spinner.Stop()
+		pterm.Fprintln(pl.writer, pterm.Red(message+" X"))
+	case ModePlain:
+		fmt.Println(message)
+	case ModeJSON:
+		EmitEvent(Event{Event: "step", Status: "failed", Message: message})
+	case ModeQuiet:
+		Errorln(message)
+	}
+}
+
+// Warn changes the line to show a non-fatal problem with custom message.
+// It looks like Fail in interactive mode but is not reported as an error in quiet mode.
+func (pl *ProgressLine) Warn(message string) {
+	switch outputMode {
+	case ModeInteractive:
+		pl.spinner.Stop()
+		pterm.Fprintln(pl.writer, pterm.Red(message+" X"))
+	case ModePlain:
+		fmt.Println(message)
+	case ModeJSON:
+		EmitEvent(Event{Event: "step", Status: "warning", Message: message})
+	}
 }
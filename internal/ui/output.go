@@ -0,0 +1,108 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+// OutputMode controls how progress and messages are written to the terminal
+type OutputMode int
+
+const (
+	ModeInteractive OutputMode = iota // Progress bars and spinners (default on a terminal)
+	ModePlain                         // One line per state change (default when stdout is not a terminal)
+	ModeJSON                          // Newline-delimited JSON events on stdout
+	ModeQuiet                         // Errors only
+)
+
+var outputMode = ModeInteractive
+
+// ParseOutputMode converts the value of the -output flag to an OutputMode.
+// "auto" picks interactive when stdout is a terminal and plain otherwise.
+func ParseOutputMode(value string) (OutputMode, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "auto":
+		if IsTerminal(os.Stdout) {
+			return ModeInteractive, nil
+		}
+		return ModePlain, nil
+	case "interactive":
+		return ModeInteractive, nil
+	case "plain":
+		return ModePlain, nil
+	case "json":
+		return ModeJSON, nil
+	case "quiet":
+		return ModeQuiet, nil
+	default:
+		return ModeInteractive, fmt.Errorf("unknown output mode %q (expected auto, interactive, plain, json or quiet)", value)
+	}
+}
+
+// SetOutputMode sets the output mode used by all ui functions.
+// It should be called once at startup, before anything is printed.
+func SetOutputMode(mode OutputMode) {
+	outputMode = mode
+}
+
+// GetOutputMode returns the current output mode
+func GetOutputMode() OutputMode {
+	return outputMode
+}
+
+// IsInteractive returns true if progress bars and spinners should be drawn
+func IsInteractive() bool {
+	return outputMode == ModeInteractive
+}
+
+// CanPrompt returns true if prompts can be shown and answered:
+// the output is interactive and stdin is a terminal
+func CanPrompt() bool {
+	return IsInteractive() && IsTerminal(os.Stdin)
+}
+
+// IsTerminal returns true if the file is attached to a terminal
+func IsTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// Println prints an informational message.
+// Informational messages are shown in interactive and plain modes only.
+func Println(a ...any) {
+	if outputMode == ModeInteractive || outputMode == ModePlain {
+		fmt.Println(a...)
+	}
+}
+
+// Printf prints a formatted informational message.
+// Informational messages are shown in interactive and plain modes only.
+func Printf(format string, a ...any) {
+	if outputMode == ModeInteractive || outputMode == ModePlain {
+		fmt.Printf(format, a...)
+	}
+}
+
+// Errorln prints an error message.
+// Errors are shown in every mode. In JSON mode they go to stderr to keep stdout machine-readable.
+func Errorln(a ...any) {
+	if outputMode == ModeJSON {
+		fmt.Fprintln(os.Stderr, a...)
+		return
+	}
+	fmt.Println(a...)
+}
+
+// Warnln prints a warning: something went wrong, but the app can continue.
+// Warnings are shown in every mode except quiet. In JSON mode they go to stderr to keep stdout machine-readable.
+func Warnln(a ...any) {
+	switch outputMode {
+	case ModeQuiet:
+	case ModeJSON:
+		fmt.Fprintln(os.Stderr, a...)
+	default:
+		fmt.Println(a...)
+	}
+}
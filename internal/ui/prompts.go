@@ -2,20 +2,23 @@ package ui
 
 import (
 	"downloader/internal/models"
+	"fmt"
 	"strings"
 
 	"github.com/AlecAivazis/survey/v2"
 )
 
-// Prompt the user to select the preferred video format
+// Prompt the user to select the preferred video container and whether other formats are converted to it
 func PromptVideoFormat() (models.VideoFormat, error) {
 	var selectedOption string
 	prompt := &survey.Select{
 		Message: "Choose your preferred video format:",
 		Options: []string{
 			"Any format",
-			"Prefer MP4 when available",
-			"Force MP4 (convert if necessary)",
+			"MP4 - plays everywhere",
+			"MKV - keeps every audio and subtitle track",
+			"WebM - open format for the web",
+			"MOV - for video editors (Final Cut, Premiere)",
 		},
 	}
 
@@ -24,14 +27,30 @@ func PromptVideoFormat() (models.VideoFormat, error) {
 		return models.FormatAny, err
 	}
 
-	switch selectedOption {
-	case "Prefer MP4 when available":
-		return models.FormatPreferMP4, nil
-	case "Force MP4 (convert if necessary)":
-		return models.FormatForceMP4, nil
-	default:
+	if selectedOption == "Any format" {
 		return models.FormatAny, nil
 	}
+
+	container := strings.ToLower(strings.Fields(selectedOption)[0])
+	name := strings.Fields(selectedOption)[0]
+
+	prompt = &survey.Select{
+		Message: fmt.Sprintf("What if the video isn't available as %s?", name),
+		Options: []string{
+			fmt.Sprintf("Prefer %s when available (keep the original format otherwise)", name),
+			fmt.Sprintf("Force %s (convert if necessary)", name),
+		},
+	}
+
+	err = survey.AskOne(prompt, &selectedOption)
+	if err != nil {
+		return models.FormatAny, err
+	}
+
+	return models.VideoFormat{
+		Container: container,
+		Force:     strings.HasPrefix(selectedOption, "Force"),
+	}, nil
 }
 
 // Prompt the user to select the download method for clips (should re-encode or not)
@@ -54,3 +73,51 @@ func PromptClipDownloadMethod() (shouldReEncode bool, err error) {
 
 	return shouldReEncode, nil
 }
+
+// Prompt the user to select the format audio downloads are converted to ("original" keeps the original format)
+func PromptAudioFormat() (string, error) {
+	var selectedOption string
+	prompt := &survey.Select{
+		Message: "Choose the audio format:",
+		Options: []string{
+			"Original (no conversion, fastest)",
+			"MP3",
+			"M4A (AAC)",
+			"Opus",
+			"FLAC (lossless)",
+			"WAV (lossless, large files)",
+		},
+	}
+
+	err := survey.AskOne(prompt, &selectedOption)
+	if err != nil {
+		return "", err
+	}
+
+	switch selectedOption {
+	case "MP3":
+		return "mp3", nil
+	case "M4A (AAC)":
+		return "m4a", nil
+	case "Opus":
+		return "opus", nil
+	case "FLAC (lossless)":
+		return "flac", nil
+	case "WAV (lossless, large files)":
+		return "wav", nil
+	default:
+		return "original", nil
+	}
+}
+
+// Ask the user whether the previous choice should be saved in the config file
+func PromptRemember() (bool, error) {
+	remember := false
+	prompt := &survey.Confirm{
+		Message: "Remember this choice for next time?",
+		Default: false,
+	}
+
+	err := survey.AskOne(prompt, &remember)
+	return remember, err
+}
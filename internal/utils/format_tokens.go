@@ -0,0 +1,284 @@
+package utils
+
+import (
+	"downloader/internal/models"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// codecAliases maps the accepted codec names to the canonical ones used in models.FormatPreferences
+var codecAliases = map[string]string{
+	"h264": "h264",
+	"avc":  "h264",
+	"avc1": "h264",
+	"h265": "h265",
+	"hevc": "h265",
+	"vp9":  "vp9",
+	"av1":  "av1",
+	"av01": "av1",
+}
+
+// ParseCodec returns the canonical codec name (h264, h265, vp9 or av1) for a codec name or alias
+func ParseCodec(name string) (string, bool) {
+	codec, ok := codecAliases[strings.ToLower(strings.TrimSpace(name))]
+	return codec, ok
+}
+
+// ParseCodecList parses a comma separated codec preference list, e.g. "h264,vp9"
+func ParseCodecList(list string) ([]string, error) {
+	var codecs []string
+	for _, name := range strings.Split(list, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		codec, ok := ParseCodec(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown codec %q (expected h264, h265, vp9 or av1)", name)
+		}
+		codecs = append(codecs, codec)
+	}
+	return codecs, nil
+}
+
+// ParseDynamicRange validates a dynamic range preference: "sdr", "hdr" or "" (any)
+func ParseDynamicRange(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "any":
+		return "", nil
+	case "sdr":
+		return "sdr", nil
+	case "hdr":
+		return "hdr", nil
+	default:
+		return "", fmt.Errorf("unknown dynamic range %q (expected sdr, hdr or any)", value)
+	}
+}
+
+// ParseVideoFormat parses a video format name: "any", "prefer-<container>" or "force-<container>",
+// a container alone is preferred ("mkv" is the same as "prefer-mkv")
+func ParseVideoFormat(name string) (models.VideoFormat, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == "any" {
+		return models.FormatAny, nil
+	}
+
+	mode, container, found := strings.Cut(name, "-")
+	if !found {
+		mode, container = "prefer", name
+	}
+
+	if mode != "prefer" && mode != "force" || !slices.Contains(models.VideoContainers, container) {
+		return models.FormatAny, fmt.Errorf("unknown video format %q (expected any, prefer-<container> or force-<container> with mp4, mkv, webm or mov)", name)
+	}
+
+	return models.VideoFormat{Container: container, Force: mode == "force"}, nil
+}
+
+var languageRegex = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]+)*$`)
+
+// ParseLanguageList parses a comma separated audio language preference list, e.g. "ar,en" or "pt-BR,en"
+func ParseLanguageList(list string) ([]string, error) {
+	var languages []string
+	for _, language := range strings.Split(list, ",") {
+		language = strings.TrimSpace(language)
+		if language == "" {
+			continue
+		}
+		if !languageRegex.MatchString(language) {
+			return nil, fmt.Errorf("invalid language code %q (expected a code like en, ar or pt-BR)", language)
+		}
+		languages = append(languages, language)
+	}
+	return languages, nil
+}
+
+var (
+	fpsTokenRegex     = regexp.MustCompile(`^(\d+)fps$`)
+	bitrateTokenRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?)(k|m)bps$`)
+)
+
+// parsePreferenceToken applies a per-line format preference token to prefs.
+// Supported tokens: codecs (h264, hevc, vp9, av1...), frame rate (30fps), sdr/hdr, bitrate (5000kbps, 8mbps),
+// audio languages (lang:ar,en) and all-audio.
+// It returns false if the token is not a format preference.
+func parsePreferenceToken(token string, prefs *models.FormatPreferences) bool {
+
+	// the language codes keep their case, yt-dlp compares them as written ("pt-BR")
+	if len(token) > 5 && strings.EqualFold(token[:5], "lang:") {
+		languages, err := ParseLanguageList(token[5:])
+		if err != nil {
+			return false
+		}
+		prefs.AudioLanguages = languages
+		return true
+	}
+
+	token = strings.ToLower(token)
+
+	if token == "all-audio" {
+		prefs.AllAudioTracks = true
+		return true
+	}
+
+	if codec, ok := ParseCodec(token); ok {
+		prefs.Codecs = append(prefs.Codecs, codec)
+		return true
+	}
+
+	if token == "sdr" || token == "hdr" {
+		prefs.DynamicRange = token
+		return true
+	}
+
+	if match := fpsTokenRegex.FindStringSubmatch(token); match != nil {
+		prefs.MaxFPS, _ = strconv.Atoi(match[1])
+		return true
+	}
+
+	if match := bitrateTokenRegex.FindStringSubmatch(token); match != nil {
+		value, _ := strconv.ParseFloat(match[1], 64)
+		if match[2] == "m" {
+			value *= 1000
+		}
+		prefs.MaxBitrate = int(value)
+		return true
+	}
+
+	return false
+}
+
+var (
+	heightTokenRegex    = regexp.MustCompile(`^(>=|<=)?(\d+)p$`)
+	maxSizeTokenRegex   = regexp.MustCompile(`^<=?(\d+(?:\.\d+)?)(k|m|g)(i?)b?$`)
+	qualityKeywordLimit = map[string]int{
+		"4k": 2160,
+		"hd": 1080,
+		"sd": 480,
+	}
+)
+
+// parseQualityToken applies a per-line quality token to quality.
+// Supported tokens: heights (720p, >=720p, <=1080p), the keywords best, worst, smallest, 4k, hd and sd,
+// and file size limits (<200MB, <1.5GB, <500MiB).
+// It returns false if the token is not a quality token.
+func parseQualityToken(token string, quality *models.Quality) bool {
+	token = strings.ToLower(token)
+
+	switch token {
+	case "best":
+		quality.Order = ""
+		return true
+	case "worst", "smallest":
+		quality.Order = token
+		return true
+	}
+
+	if height, ok := qualityKeywordLimit[token]; ok {
+		quality.MaxHeight = height
+		return true
+	}
+
+	if match := heightTokenRegex.FindStringSubmatch(token); match != nil {
+		height, _ := strconv.Atoi(match[2])
+		if match[1] == ">=" {
+			quality.MinHeight = height
+		} else {
+			quality.MaxHeight = height
+		}
+		return true
+	}
+
+	if match := maxSizeTokenRegex.FindStringSubmatch(token); match != nil {
+		value, _ := strconv.ParseFloat(match[1], 64)
+
+		// MB is decimal (1000 KB), MiB is binary (1024 KiB)
+		base := 1000.0
+		if match[3] == "i" {
+			base = 1024
+		}
+
+		switch match[2] {
+		case "k":
+			value *= base
+		case "m":
+			value *= base * base
+		case "g":
+			value *= base * base * base
+		}
+		quality.MaxSize = int64(value)
+		return true
+	}
+
+	return false
+}
+
+// audioFormatAliases maps the accepted audio format names to the yt-dlp --audio-format values
+var audioFormatAliases = map[string]string{
+	"original": "",
+	"mp3":      "mp3",
+	"m4a":      "m4a",
+	"aac":      "m4a",
+	"opus":     "opus",
+	"flac":     "flac",
+	"wav":      "wav",
+}
+
+var (
+	audioBitrateRegex = regexp.MustCompile(`^(\d+)k$`)
+	audioVBRRegex     = regexp.MustCompile(`^q(\d+)$`)
+)
+
+// ParseAudioFormat returns the yt-dlp audio format for a format name: mp3, m4a (or aac), opus, flac, wav or original ("")
+func ParseAudioFormat(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "", nil
+	}
+
+	format, ok := audioFormatAliases[name]
+	if !ok {
+		return "", fmt.Errorf("unknown audio format %q (expected mp3, m4a, opus, flac, wav or original)", name)
+	}
+	return format, nil
+}
+
+// ParseAudioQuality returns the yt-dlp audio quality for a bitrate (e.g. "192k") or a VBR quality from q0 (best) to q10
+func ParseAudioQuality(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	if value == "" {
+		return "", nil
+	}
+
+	if match := audioBitrateRegex.FindStringSubmatch(value); match != nil {
+		return match[1] + "K", nil
+	}
+
+	if match := audioVBRRegex.FindStringSubmatch(value); match != nil {
+		if quality, _ := strconv.Atoi(match[1]); quality <= 10 {
+			return match[1], nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid audio quality %q (expected a bitrate like 192k or a VBR quality from q0 to q10)", value)
+}
+
+// ParseAudioOutput parses an audio output spec "<format>[@<quality>]", e.g. "mp3@192k", "opus@q5" or "flac"
+func ParseAudioOutput(spec string) (models.AudioOutput, error) {
+	formatName, qualityValue, _ := strings.Cut(spec, "@")
+
+	format, err := ParseAudioFormat(formatName)
+	if err != nil {
+		return models.AudioOutput{}, err
+	}
+
+	quality, err := ParseAudioQuality(qualityValue)
+	if err != nil {
+		return models.AudioOutput{}, err
+	}
+
+	return models.AudioOutput{Format: format, Quality: quality}, nil
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"downloader/internal/models"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// retry files are named failed-<timestamp>.txt, the timestamp format keeps them sorted by name
+const (
+	retryFilePattern   = "failed-*.txt"
+	retryFileTimestamp = "20060102-150405"
+)
+
+// WriteRetryFile writes the failed requests to failed-<timestamp>.txt in dir, using the urls.txt syntax.
+// Each request is written as its original line, preceded by a comment with the failure reason.
+// It returns the path of the written file.
+func WriteRetryFile(dir string, failures []*models.DownloadError) (string, error) {
+	var content strings.Builder
+
+	now := time.Now()
+	fmt.Fprintf(&content, "# Failed downloads from %s\n", now.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&content, "# Run \"downloader retry\" to download them again\n")
+
+	// keep the order of the input file
+	sorted := append([]*models.DownloadError(nil), failures...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Request.Line < sorted[j].Request.Line
+	})
+
+	written := make(map[int]bool)
+	for _, failure := range sorted {
+		// a request is written once even if it has several errors
+		if failure.Recovered || written[failure.Request.Line] {
+			continue
+		}
+		written[failure.Request.Line] = true
+
+		reason := strings.Join(strings.Fields(failure.Message), " ")
+		fmt.Fprintf(&content, "\n# line %d, %s: %s\n", failure.Request.Line, failure.Phase, reason)
+		fmt.Fprintln(&content, failure.Request.Raw)
+	}
+
+	path := filepath.Join(dir, "failed-"+now.Format(retryFileTimestamp)+".txt")
+	if err := os.WriteFile(path, []byte(content.String()), 0644); err != nil {
+		return "", fmt.Errorf("couldn't write the retry file: %v", err)
+	}
+
+	return path, nil
+}
+
+// LatestRetryFile returns the path of the most recent retry file in dir
+func LatestRetryFile(dir string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, retryFilePattern))
+	if err != nil {
+		return "", err
+	}
+
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no failed-*.txt file found in %s", dir)
+	}
+
+	sort.Strings(matches)
+	return matches[len(matches)-1], nil
+}
+
+// MarkRetryFileDone renames a retry file after it was retried, so the next retry picks a newer one
+func MarkRetryFileDone(path string) error {
+	return os.Rename(path, path+".retried")
+}
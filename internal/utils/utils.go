@@ -5,8 +5,6 @@ import (
 	"downloader/internal/models"
 	"fmt"
 	"os"
-	"path/filepath"
-	"runtime"
 	"strings"
 	"time"
 	"unicode"
@@ -14,29 +12,34 @@ import (
 	"github.com/fatih/color"
 )
 
-// ReadLinesFromFile reads lines from a file and returns them as a slice of strings.
-// It ignores empty lines and removes leading and trailing whitespace from each line.
-func ReadLinesFromFile(fileName string) ([]string, error) {
+// ReadRequestsFromFile reads download requests from a file, one per line.
+// It ignores empty lines and comment lines starting with "#", and removes leading and trailing whitespace from each line.
+// Each request keeps its line number and original text so failures can be traced back to the file.
+func ReadRequestsFromFile(fileName string) ([]models.DownloadRequest, error) {
 	file, err := os.Open(fileName)
 
 	if err != nil {
-		return []string{}, fmt.Errorf("couldn't open the file: %v", err)
+		return []models.DownloadRequest{}, fmt.Errorf("couldn't open the file: %v", err)
 	}
 
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
 
-	var urls []string
+	var requests []models.DownloadRequest
+	lineNumber := 0
 
 	for scanner.Scan() {
+		lineNumber++
 		line := strings.TrimSpace(scanner.Text())
 
-		if line != "" {
-			urls = append(urls, line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			req := ParseDownloadRequest(line)
+			req.Line = lineNumber
+			requests = append(requests, req)
 		}
 	}
-	return urls, nil
+	return requests, scanner.Err()
 }
 
 // create a download request object from a line of text
@@ -44,7 +47,11 @@ func ReadLinesFromFile(fileName string) ([]string, error) {
 // - the first part is the url
 // - for clip download, the line must contain a time range in the format HH:MM:SS-HH:MM:SS
 // - for both clip and full video download, the quality can be specified using any number with "p" suffix (e.g., 1440p,1080p, 720p)
-// - for audio-only download, the line must contain the keyword "audio"
+// - the quality can also be a minimum (>=720p), the keywords best, worst, smallest, 4k, hd and sd, or a file size limit (<200MB)
+// - for audio-only download, the line must contain the keyword "audio", or "audio:<format>[@<quality>]" to convert it (e.g. audio:mp3@192k)
+// - video format preferences can be given as codecs (h264, hevc, vp9, av1), frame rate (30fps), sdr/hdr and bitrate (5000kbps, 8mbps)
+// - the audio languages can be given in order of preference (lang:ar,en), all-audio keeps every audio track
+// - a named profile of the config file can be applied with profile:<name>
 //
 // Examples:
 // - https://www.video.com/watch?v=dQw4w9WgXcQ    (download the full video in best quality)
@@ -53,6 +60,10 @@ func ReadLinesFromFile(fileName string) ([]string, error) {
 // - https://www.video.com/watch?v=dQw4w9WgXcQ 1080p 00:00:00-00:01:00    (download a clip from 00:00:00 to 00:01:00 in 1080p quality)
 // - https://www.video.com/watch?v=dQw4w9WgXcQ audio    (download the full audio in best quality)
 // - https://www.video.com/watch?v=dQw4w9WgXcQ audio 00:00:00-00:01:00    (download an audio clip from 00:00:00 to 00:01:00)
+// - https://www.video.com/watch?v=dQw4w9WgXcQ audio:mp3@192k    (download the full audio and convert it to a 192 kbps mp3)
+// - https://www.video.com/watch?v=dQw4w9WgXcQ >=720p <200MB    (download the full video in at least 720p, in a file under 200 MB)
+// - https://www.video.com/watch?v=dQw4w9WgXcQ 1080p h264 30fps sdr    (download the full video in 1080p, preferring H.264 at 30fps in SDR)
+// - https://www.video.com/watch?v=dQw4w9WgXcQ lang:ar,en    (download the full video with the Arabic audio track, or English if there is none)
 func ParseDownloadRequest(line string) models.DownloadRequest {
 
 	// split the line by spaces
@@ -60,6 +71,7 @@ func ParseDownloadRequest(line string) models.DownloadRequest {
 
 	// the first part is the url
 	req := models.DownloadRequest{
+		Raw: line,
 		Url: parts[0],
 	}
 
@@ -68,18 +80,33 @@ func ParseDownloadRequest(line string) models.DownloadRequest {
 		for i := 1; i < len(parts); i++ {
 			if strings.ToLower(parts[i]) == "audio" {
 				req.IsAudioOnly = true
+			} else if spec, ok := strings.CutPrefix(strings.ToLower(parts[i]), "audio:"); ok {
+				// an invalid spec still downloads the audio, in its original format
+				req.IsAudioOnly = true
+				output, err := ParseAudioOutput(spec)
+				if err != nil {
+					req.UnknownTokens = append(req.UnknownTokens, parts[i])
+				}
+				req.AudioOutput = output
+			} else if name, ok := strings.CutPrefix(strings.ToLower(parts[i]), "profile:"); ok && name != "" {
+				req.Profile = name
+			} else if parsePreferenceToken(parts[i], &req.Preferences) {
+				continue
+			} else if parseQualityToken(parts[i], &req.Quality) {
+				continue
 			} else if strings.Contains(parts[i], "-") {
 				req.IsClip = true
 				req.ClipTimeRange = parts[i]
-			} else if strings.HasSuffix(parts[i], "p") {
-				req.Quality = strings.TrimSuffix(parts[i], "p")
+			} else {
+				req.UnknownTokens = append(req.UnknownTokens, parts[i])
 			}
 		}
 	}
 
-	// If audio is requested, ignore quality setting
+	// If audio is requested, ignore quality setting and video preferences, only the audio languages are kept
 	if req.IsAudioOnly {
-		req.Quality = ""
+		req.Quality = models.Quality{}
+		req.Preferences = models.FormatPreferences{AudioLanguages: req.Preferences.AudioLanguages}
 	}
 
 	return req
@@ -134,20 +161,6 @@ func SanitizeFilename(filename string) string {
 	return string(sanitized)
 }
 
-// Returns the absolute path to the binary to be executed based on the OS
-func GetBinaryPath(binaryName string) string {
-	if runtime.GOOS == "windows" {
-		binaryName += ".exe"
-	}
-
-	binPath := filepath.Join("bin", binaryName)
-	abs, err := filepath.Abs(binPath)
-	if err != nil {
-		return binaryName
-	}
-	return abs
-}
-
 // FormatDuration formats a duration in seconds to a human-readable string (e.g., "2m 30s")
 func FormatDuration(seconds int) string {
 	m := seconds / 60
@@ -169,8 +182,3 @@ func FormatClipDurationText(timeRange string) string {
 		startTime,
 		endTime)
 }
-
-// IsYouTubeURL returns true if the URL is a YouTube link.
-func IsYouTubeURL(url string) bool {
-	return strings.Contains(url, "youtube.com") || strings.Contains(url, "youtu.be")
-}